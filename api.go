@@ -0,0 +1,421 @@
+package xpd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const defaultApiPageSize = 50
+
+const maxApiPageSize = 1000
+
+// maximum size of the bodies of requests, in bytes
+const maxApiRequestSize = 1 << 20
+
+// api serves JSON about the feeds, posts and events of a Context
+type api struct {
+	context *Context
+}
+
+type apiFeed struct {
+	Id            string    `json:"id"`
+	Url           string    `json:"url"`
+	Healthy       bool      `json:"healthy"`
+	Fetches       int       `json:"fetches"`
+	Errors        int       `json:"errors"`
+	Posts         int       `json:"posts"`
+	LastFetch     time.Time `json:"lastFetch"`
+	LastSuccess   time.Time `json:"lastSuccess"`
+	LastError     string    `json:"lastError"`
+	LastErrorTime time.Time `json:"lastErrorTime"`
+}
+
+type apiPost struct {
+	PostRecord
+	Body string `json:"body"`
+}
+
+type apiEvent struct {
+	Id int `json:"id"`
+	EventRecord
+}
+
+type apiCluster struct {
+	Feeds  []string     `json:"feeds"`
+	Posts  []PostRecord `json:"posts"`
+	Events []int        `json:"events"`
+	Latest time.Time    `json:"latest"`
+}
+
+type apiPage struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Items  interface{} `json:"items"`
+}
+
+type apiMatchRequest struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Author  string `json:"author"`
+	// optional, to tell apart duplicates and cross-posts
+	Feed string `json:"feed"`
+}
+
+type apiMatch struct {
+	Detector   string    `json:"detector"`
+	Duplicates []apiPost `json:"duplicates"`
+	CrossPosts []apiPost `json:"crossPosts"`
+}
+
+// unique ids for ad-hoc posts, so that detectors don't confuse them with stored posts
+var apiMatchCounter int64
+
+func (api *api) feeds(w http.ResponseWriter, r *http.Request) {
+	var feeds []apiFeed
+	for _, status := range api.context.Monitor.Statuses() {
+		feeds = append(feeds, apiFeed{
+			Id:            status.Feed.Id,
+			Url:           status.Feed.Url,
+			Healthy:       status.Healthy(),
+			Fetches:       status.Fetches,
+			Errors:        status.Errors,
+			Posts:         status.Posts,
+			LastFetch:     status.LastFetch,
+			LastSuccess:   status.LastSuccess,
+			LastError:     status.LastError,
+			LastErrorTime: status.LastErrorTime,
+		})
+	}
+	writeJSON(w, http.StatusOK, feeds)
+}
+
+// posts lists the stored posts, newest first, optionally filtered by
+// feed, author, and publication time (since, until; in RFC 3339 format)
+func (api *api) posts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var since, until time.Time
+	for name, t := range map[string]*time.Time{"since": &since, "until": &until} {
+		if s := query.Get(name); s != "" {
+			value, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %s", name, s))
+				return
+			}
+			*t = value
+		}
+	}
+
+	offset, limit, err := parsePaging(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	feed, author := query.Get("feed"), query.Get("author")
+	recent := api.context.PostRepository.FindRecent()
+	var posts []apiPost
+	for i := len(recent) - 1; i >= 0; i-- {
+		post := recent[i]
+		if feed != "" && post.Feed.Id != feed ||
+			author != "" && post.Author != author ||
+			!since.IsZero() && post.Time.Before(since) ||
+			!until.IsZero() && !post.Time.Before(until) {
+			continue
+		}
+		posts = append(posts, newApiPost(post))
+	}
+
+	start, end := pageBounds(offset, limit, len(posts))
+	writeJSON(w, http.StatusOK, apiPage{Total: len(posts), Offset: offset, Limit: limit, Items: append([]apiPost{}, posts[start:end]...)})
+}
+
+// events lists the recent events, newest first, optionally filtered by kind and feed
+func (api *api) events(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := parsePaging(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	kind, feed := EventKind(r.URL.Query().Get("kind")), r.URL.Query().Get("feed")
+	recent := api.context.Events.FindRecent()
+	var events []apiEvent
+	for i := len(recent) - 1; i >= 0; i-- {
+		event := recent[i]
+		if kind != "" && event.Kind != kind || feed != "" && !containsAny(event.feedIds(), []string{feed}) {
+			continue
+		}
+		events = append(events, apiEvent{Id: event.Id, EventRecord: newEventRecord(event.Event)})
+	}
+
+	start, end := pageBounds(offset, limit, len(events))
+	writeJSON(w, http.StatusOK, apiPage{Total: len(events), Offset: offset, Limit: limit, Items: append([]apiEvent{}, events[start:end]...)})
+}
+
+func (api *api) event(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/events/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such event: %s", r.URL.Path))
+		return
+	}
+	event, ok := api.context.Events.Find(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such event: %d", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, apiEvent{Id: event.Id, EventRecord: newEventRecord(event.Event)})
+}
+
+// clusters groups the posts of the recent events that have posts in common, most recent first
+func (api *api) clusters(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := parsePaging(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	clusters := buildClusters(api.context.Events.FindRecent())
+	start, end := pageBounds(offset, limit, len(clusters))
+	writeJSON(w, http.StatusOK, apiPage{Total: len(clusters), Offset: offset, Limit: limit, Items: append([]apiCluster{}, clusters[start:end]...)})
+}
+
+// match tells which stored posts the given post would match, by each detector,
+// comparing the posts as the detections do, and leaving out the suppressed matches
+func (api *api) match(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("use POST"))
+		return
+	}
+
+	var request apiMatchRequest
+	reader := http.MaxBytesReader(w, r.Body, maxApiRequestSize)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(reader).Decode(&request); err != nil {
+			writeError(w, requestBodyStatus(err), fmt.Errorf("invalid JSON: %s", err))
+			return
+		}
+	} else {
+		body, err := ioutil.ReadAll(reader)
+		if err != nil {
+			writeError(w, requestBodyStatus(err), err)
+			return
+		}
+		request.Body = string(body)
+	}
+
+	post := Post{
+		Id:      fmt.Sprintf("xpd-api-match-%d", atomic.AddInt64(&apiMatchCounter, 1)),
+		Author:  request.Author,
+		Subject: request.Subject,
+		Body:    request.Body,
+		Time:    time.Now(),
+		Feed:    &Feed{Id: request.Feed},
+	}
+
+	// compared like admitted posts, without teaching the boilerplate of its feed
+	post = stripQuotes(api.context.boilerplate.stripLearned(post))
+	others := excludeThread(post, api.context.PostRepository.FindRecent())
+	recent := make([]Post, len(others))
+	for i, other := range others {
+		recent[i] = other.forDetection()
+	}
+
+	detectors, _ := api.context.components()
+	matches := make([]apiMatch, len(detectors))
+	for i, detector := range detectors {
+		found, _ := api.context.Suppressions.filter(post, detector.FindDuplicates(r.Context(), post, recent))
+		for j, match := range found {
+			found[j] = match.asFetched()
+		}
+		dups, cross := splitDupsAndCrossPosts(post, found)
+		matches[i] = apiMatch{Detector: detectorName(detector), Duplicates: newApiPosts(dups), CrossPosts: newApiPosts(cross)}
+	}
+	writeJSON(w, http.StatusOK, matches)
+}
+
+// suppressions lists the suppressions that have not expired (GET), or adds one (POST)
+func (api *api) suppressions(w http.ResponseWriter, r *http.Request) {
+	store := api.context.Suppressions
+	if store == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("suppressions are not configured, see suppressions.file"))
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		suppressions, err := store.List()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, suppressions)
+	case "POST":
+		var suppression Suppression
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxApiRequestSize)).Decode(&suppression); err != nil {
+			writeError(w, requestBodyStatus(err), fmt.Errorf("invalid JSON: %s", err))
+			return
+		}
+		added, err := store.Add(suppression)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, added)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("use GET or POST"))
+	}
+}
+
+// suppression removes a suppression (DELETE)
+func (api *api) suppression(w http.ResponseWriter, r *http.Request) {
+	store := api.context.Suppressions
+	if store == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("suppressions are not configured, see suppressions.file"))
+		return
+	}
+	if r.Method != "DELETE" {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("use DELETE"))
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/suppressions/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such suppression: %s", r.URL.Path))
+		return
+	}
+	if err := store.Remove(id); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newApiPost(post Post) apiPost {
+	return apiPost{PostRecord: newPostRecord(post), Body: post.Body}
+}
+
+func newApiPosts(posts []Post) []apiPost {
+	items := make([]apiPost, len(posts))
+	for i, post := range posts {
+		items[i] = newApiPost(post)
+	}
+	return items
+}
+
+func buildClusters(events []StoredEvent) []apiCluster {
+	// union-find of the post keys, to merge events with posts in common
+	parents := make(map[string]string)
+	var find func(string) string
+	find = func(key string) string {
+		if parent, ok := parents[key]; ok && parent != key {
+			root := find(parent)
+			parents[key] = root
+			return root
+		}
+		parents[key] = key
+		return key
+	}
+
+	for _, event := range events {
+		keys := event.postKeys()
+		for _, key := range keys[1:] {
+			parents[find(key)] = find(keys[0])
+		}
+	}
+
+	byRoot := make(map[string]*apiCluster)
+	seen := make(map[string]bool)
+	var clusters []*apiCluster
+	for _, event := range events {
+		root := find(postKey(event.Post))
+		cluster, ok := byRoot[root]
+		if !ok {
+			cluster = &apiCluster{}
+			byRoot[root] = cluster
+			clusters = append(clusters, cluster)
+		}
+		cluster.Events = append(cluster.Events, event.Id)
+		if event.Time.After(cluster.Latest) {
+			cluster.Latest = event.Time
+		}
+		for _, post := range append([]Post{event.Post}, event.Posts...) {
+			if key := postKey(post); !seen[key] {
+				seen[key] = true
+				cluster.Posts = append(cluster.Posts, newPostRecord(post))
+				if !containsAny(cluster.Feeds, []string{post.Feed.Id}) {
+					cluster.Feeds = append(cluster.Feeds, post.Feed.Id)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].Latest.After(clusters[j].Latest)
+	})
+
+	result := make([]apiCluster, len(clusters))
+	for i, cluster := range clusters {
+		result[i] = *cluster
+	}
+	return result
+}
+
+func parsePaging(r *http.Request) (offset, limit int, err error) {
+	query := r.URL.Query()
+	limit = defaultApiPageSize
+	if s := query.Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", s)
+		}
+	}
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > maxApiPageSize {
+			return 0, 0, fmt.Errorf("invalid limit: %s (must be between 1 and %d)", s, maxApiPageSize)
+		}
+	}
+	return offset, limit, nil
+}
+
+// pageBounds are the start and end indexes of the page of items from offset, up to limit
+func pageBounds(offset, limit, total int) (int, int) {
+	start, end := offset, offset+limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error: api: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// requestBodyStatus is the status of an error reading the body of a request, larger than maxApiRequestSize or invalid
+func requestBodyStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,230 @@
+package xpd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newApiTestContext() *Context {
+	so := &Feed{Id: "so"}
+	gg := &Feed{Id: "gg"}
+	t0 := time.Date(2016, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	repo := NewPostRepository()
+	posts := []Post{
+		{Id: "1", Author: "jack", Body: "the quick brown fox", Time: t0, Feed: so},
+		{Id: "2", Author: "jill", Body: "something else entirely", Time: t0.Add(time.Hour), Feed: so},
+		{Id: "3", Author: "jack", Body: "the quick brown fox", Time: t0.Add(2 * time.Hour), Feed: gg},
+		{Id: "4", Author: "jack", Body: "the quick brown fox", Time: t0.Add(3 * time.Hour), Feed: so},
+	}
+	for _, post := range posts {
+		repo.Add(post)
+	}
+
+	events := NewEventStore()
+	events.OnCrossPost(context.Background(), posts[2], []Post{posts[0]})
+	events.OnDuplicate(context.Background(), posts[1], []Post{{Id: "5", Feed: so}})
+	events.OnCrossPost(context.Background(), posts[3], []Post{posts[2]})
+
+	monitor := NewFeedMonitor()
+	monitor.record(*so, 3, nil)
+
+	return &Context{
+		Detectors:      []Detector{SameBodyDetector{}, NewSimilarWordCountDetector(0.1)},
+		PostRepository: repo,
+		Monitor:        monitor,
+		Events:         events,
+	}
+}
+
+func request(t *testing.T, context *Context, method, path, contentType, body string, v interface{}) int {
+	recorder := httptest.NewRecorder()
+	r, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	r.Header.Set("Authorization", "Bearer hunter2")
+	NewServeMux(context, HTTPConfig{Token: "hunter2"}).ServeHTTP(recorder, r)
+
+	if v != nil && recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+			t.Fatalf("got invalid JSON: %s\n%s", err, recorder.Body.String())
+		}
+	}
+	return recorder.Code
+}
+
+type apiTestPage struct {
+	Total int
+	Items []map[string]interface{}
+}
+
+func Test_api_feeds(t *testing.T) {
+	var feeds []apiFeed
+	request(t, newApiTestContext(), "GET", "/api/feeds", "", "", &feeds)
+	if len(feeds) != 1 || feeds[0].Id != "so" || !feeds[0].Healthy || feeds[0].Posts != 3 {
+		t.Fatalf("got %#v; expected the healthy feed", feeds)
+	}
+}
+
+func Test_api_posts_filters_and_paginates(t *testing.T) {
+	context := newApiTestContext()
+
+	cases := map[string][]string{
+		"/api/posts":                                    {"4", "3", "2", "1"},
+		"/api/posts?feed=so":                            {"4", "2", "1"},
+		"/api/posts?author=jack&limit=2":                {"4", "3"},
+		"/api/posts?author=jack&limit=2&offset=2":       {"1"},
+		"/api/posts?since=2016-03-01T11:00:00Z":         {"4", "3", "2"},
+		"/api/posts?until=2016-03-01T11:00:00Z":         {"1"},
+		"/api/posts?offset=10":                          {},
+		"/api/posts?feed=so&since=2016-03-01T12:00:00Z": {"4"},
+	}
+	for path, expected := range cases {
+		var page apiTestPage
+		if code := request(t, context, "GET", path, "", "", &page); code != http.StatusOK {
+			t.Errorf("got status %d for %s; expected 200", code, path)
+			continue
+		}
+		var ids []string
+		for _, item := range page.Items {
+			ids = append(ids, item["id"].(string))
+		}
+		if strings.Join(ids, ",") != strings.Join(expected, ",") {
+			t.Errorf("got %v for %s; expected %v", ids, path, expected)
+		}
+	}
+
+	for _, path := range []string{"/api/posts?limit=0", "/api/posts?offset=-1", "/api/posts?since=yesterday"} {
+		if code := request(t, context, "GET", path, "", "", nil); code != http.StatusBadRequest {
+			t.Errorf("got status %d for %s; expected 400", code, path)
+		}
+	}
+}
+
+func Test_api_events(t *testing.T) {
+	context := newApiTestContext()
+
+	var page apiTestPage
+	request(t, context, "GET", "/api/events?kind=cross-post", "", "", &page)
+	if page.Total != 2 || page.Items[0]["id"].(float64) != 3 {
+		t.Fatalf("got %#v; expected the 2 cross-posts, newest first", page)
+	}
+
+	var event apiEvent
+	if code := request(t, context, "GET", "/api/events/2", "", "", &event); code != http.StatusOK || event.Kind != DuplicateEvent {
+		t.Fatalf("got %d, %#v; expected the duplicate event", code, event)
+	}
+	if code := request(t, context, "GET", "/api/events/9", "", "", nil); code != http.StatusNotFound {
+		t.Fatalf("got status %d; expected 404", code)
+	}
+}
+
+func Test_api_clusters(t *testing.T) {
+	var page struct {
+		Total int
+		Items []apiCluster
+	}
+	request(t, newApiTestContext(), "GET", "/api/clusters", "", "", &page)
+
+	if page.Total != 2 {
+		t.Fatalf("got %d clusters; expected the 2 cross-posts merged into 1, plus the duplicate", page.Total)
+	}
+	cluster := page.Items[0]
+	if len(cluster.Posts) != 3 || len(cluster.Events) != 2 || len(cluster.Feeds) != 2 {
+		t.Fatalf("got %#v; expected 3 posts of 2 events in 2 feeds", cluster)
+	}
+}
+
+func Test_api_match(t *testing.T) {
+	context := newApiTestContext()
+
+	var matches []apiMatch
+	code := request(t, context, "POST", "/api/match", "application/json", `{"body": "the quick brown fox", "feed": "gg"}`, &matches)
+	if code != http.StatusOK || len(matches) != 2 {
+		t.Fatalf("got %d, %#v; expected results of 2 detectors", code, matches)
+	}
+	if matches[0].Detector != "SameBodyDetector" || len(matches[0].Duplicates) != 1 || len(matches[0].CrossPosts) != 2 {
+		t.Fatalf("got %#v; expected 1 duplicate and 2 cross-posts", matches[0])
+	}
+
+	matches = nil
+	request(t, context, "POST", "/api/match", "text/plain", "nothing like it", &matches)
+	if len(matches[0].CrossPosts) != 0 || len(matches[1].CrossPosts) != 0 {
+		t.Fatalf("got %#v; expected no matches", matches)
+	}
+
+	if code := request(t, context, "GET", "/api/match", "", "", nil); code != http.StatusMethodNotAllowed {
+		t.Fatalf("got status %d; expected 405", code)
+	}
+	if code := request(t, context, "POST", "/api/match", "application/json", "{", nil); code != http.StatusBadRequest {
+		t.Fatalf("got status %d; expected 400", code)
+	}
+	tooLarge := strings.Repeat("word ", maxApiRequestSize/5+1)
+	if code := request(t, context, "POST", "/api/match", "text/plain", tooLarge, nil); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got status %d; expected 413", code)
+	}
+}
+
+func Test_api_requires_token_unless_get(t *testing.T) {
+	context := newApiTestContext()
+	for _, example := range []struct {
+		config        HTTPConfig
+		method        string
+		authorization string
+		expected      int
+	}{
+		{HTTPConfig{}, "POST", "", http.StatusForbidden},
+		{HTTPConfig{Token: "hunter2"}, "POST", "", http.StatusUnauthorized},
+		{HTTPConfig{Token: "hunter2"}, "POST", "Bearer hunter3", http.StatusUnauthorized},
+		{HTTPConfig{Token: "hunter2"}, "POST", "Bearer hunter2", http.StatusOK},
+		{HTTPConfig{}, "GET", "", http.StatusMethodNotAllowed},
+	} {
+		recorder := httptest.NewRecorder()
+		r, _ := http.NewRequest(example.method, "/api/match", strings.NewReader("the quick brown fox"))
+		if example.authorization != "" {
+			r.Header.Set("Authorization", example.authorization)
+		}
+		NewServeMux(context, example.config).ServeHTTP(recorder, r)
+		if recorder.Code != example.expected {
+			t.Errorf("got %d; expected %d with %#v", recorder.Code, example.expected, example)
+		}
+	}
+}
+
+func Test_api_match_compares_posts_as_detected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	context := newApiTestContext()
+	gg := &Feed{Id: "gg"}
+	context.PostRepository.Add(Post{Id: "6", Author: "jill", Body: "<p>the quick brown fox</p><p>-- jill</p>", stripped: "<p>the quick brown fox</p>", Feed: gg})
+	context.Suppressions, err = OpenSuppressionStore(filepath.Join(dir, "suppressions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	context.Suppressions.Add(Suppression{Kind: SuppressAuthor, Author: "jack"})
+
+	var matches []apiMatch
+	request(t, context, "POST", "/api/match", "application/json", `{"body": "<p>the quick brown fox</p>", "feed": "so"}`, &matches)
+	if len(matches[0].Duplicates) != 0 || len(matches[0].CrossPosts) != 1 {
+		t.Fatalf("got %#v; expected only the match of the post not suppressed", matches[0])
+	}
+	if body := matches[0].CrossPosts[0].Body; body != "<p>the quick brown fox</p><p>-- jill</p>" {
+		t.Fatalf("got %s; expected the post compared without its boilerplate, reported as fetched", body)
+	}
+}
@@ -0,0 +1,216 @@
+package xpd
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const defaultBoilerplateMinPosts = 5
+
+const defaultBoilerplateWindow = 200
+
+// BoilerplateConfig configures the learning of the boilerplate of feeds, like the footers of mailing lists,
+// removed from new posts before detection, together with the ignorePatterns of feeds
+type BoilerplateConfig struct {
+	// a line in at least this many of the recent posts of a feed is boilerplate, default 5
+	MinPosts int `yaml:"minPosts"`
+	// number of recent posts of each feed to learn from, default 200
+	Window int
+	// only remove the lines matching the ignorePatterns of feeds
+	Disabled bool
+}
+
+func (config BoilerplateConfig) minPosts() int {
+	if config.MinPosts <= 0 {
+		return defaultBoilerplateMinPosts
+	}
+	return config.MinPosts
+}
+
+func (config BoilerplateConfig) window() int {
+	if config.Window <= 0 {
+		return defaultBoilerplateWindow
+	}
+	return config.Window
+}
+
+// ends the segments of a body, compared to find the boilerplate: lines, paragraphs, items, ...
+var boilerplateSegmentEnds = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|pre|h[1-6]|blockquote|tr)>|\n`)
+
+// boilerplate removes the boilerplate from the body of new posts, learned per feed from their recent posts
+type boilerplate struct {
+	// guards config, patterns and feeds
+	mutex    sync.Mutex
+	config   BoilerplateConfig
+	patterns map[string][]*regexp.Regexp
+	feeds    map[string]*feedBoilerplate
+}
+
+// feedBoilerplate counts the posts of a feed each line is in, over a window of recent posts
+type feedBoilerplate struct {
+	counts map[string]int
+	// the lines of each recent post, oldest first
+	recent [][]string
+}
+
+func newBoilerplate(config BoilerplateConfig, feeds []Feed) (*boilerplate, error) {
+	boilerplate := &boilerplate{feeds: make(map[string]*feedBoilerplate)}
+	if err := boilerplate.configure(config, feeds); err != nil {
+		return nil, err
+	}
+	return boilerplate, nil
+}
+
+// configure replaces the configuration and the ignorePatterns of the feeds, keeping the boilerplate learned
+func (boilerplate *boilerplate) configure(config BoilerplateConfig, feeds []Feed) error {
+	patterns := make(map[string][]*regexp.Regexp)
+	for _, feed := range feeds {
+		for _, s := range feed.IgnorePatterns {
+			pattern, err := compileIgnorePattern(s)
+			if err != nil {
+				return fmt.Errorf("feed %s: %s", feed.Id, err)
+			}
+			patterns[feed.Id] = append(patterns[feed.Id], pattern)
+		}
+	}
+
+	boilerplate.mutex.Lock()
+	defer boilerplate.mutex.Unlock()
+	boilerplate.config = config
+	boilerplate.patterns = patterns
+	return nil
+}
+
+func compileIgnorePattern(s string) (*regexp.Regexp, error) {
+	pattern, err := regexp.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ignore pattern: %s", s)
+	}
+	return pattern, nil
+}
+
+// strip learns the lines of the post, and returns it without the lines that are boilerplate of its feed,
+// or matching its ignorePatterns.
+// If nothing would remain, the post is returned unchanged. A nil boilerplate changes nothing.
+func (boilerplate *boilerplate) strip(post Post) Post {
+	return boilerplate.remove(post, !post.Edited)
+}
+
+// stripLearned is like strip, without learning the lines of the post,
+// for posts that are not admitted, like those of API requests
+func (boilerplate *boilerplate) stripLearned(post Post) Post {
+	return boilerplate.remove(post, false)
+}
+
+func (boilerplate *boilerplate) remove(post Post, learn bool) Post {
+	if boilerplate == nil || post.Feed == nil {
+		return post
+	}
+	boilerplate.mutex.Lock()
+	defer boilerplate.mutex.Unlock()
+
+	segments := splitSegments(post.Body)
+	texts := make([]string, len(segments))
+	for i, segment := range segments {
+		texts[i] = segmentText(segment)
+	}
+	var feed *feedBoilerplate
+	if learn {
+		feed = boilerplate.learn(post.Feed.Id, texts)
+	} else if !boilerplate.config.Disabled {
+		// the lines of edited posts were learned when they were new
+		feed = boilerplate.feeds[post.Feed.Id]
+	}
+	patterns := boilerplate.patterns[post.Feed.Id]
+
+	var kept []string
+	removed := false
+	for i, segment := range segments {
+		if texts[i] != "" && (feed != nil && feed.counts[texts[i]] >= boilerplate.config.minPosts() || matchesAny(patterns, texts[i])) {
+			removed = true
+			continue
+		}
+		// including markup without text, like closing tags
+		kept = append(kept, segment)
+	}
+	body := strings.Join(kept, "")
+	if !removed || segmentText(body) == "" {
+		return post
+	}
+	post.Body = body
+	return post
+}
+
+// stripPosts returns the posts as compared by the detectors when running: without their quotes,
+// nor the boilerplate of their feeds, learned from the posts in order
+func (boilerplate *boilerplate) stripPosts(posts []Post) []Post {
+	stripped := make([]Post, len(posts))
+	for i, post := range posts {
+		stripped[i] = stripQuotes(boilerplate.strip(post))
+	}
+	return stripped
+}
+
+// learn adds the distinct lines of a post of the feed to the window, returning nil if learning is disabled
+func (boilerplate *boilerplate) learn(feedId string, texts []string) *feedBoilerplate {
+	if boilerplate.config.Disabled {
+		return nil
+	}
+	feed, ok := boilerplate.feeds[feedId]
+	if !ok {
+		feed = &feedBoilerplate{counts: make(map[string]int)}
+		boilerplate.feeds[feedId] = feed
+	}
+
+	seen := make(map[string]bool)
+	var distinct []string
+	for _, text := range texts {
+		if text != "" && !seen[text] {
+			seen[text] = true
+			distinct = append(distinct, text)
+			feed.counts[text]++
+		}
+	}
+	feed.recent = append(feed.recent, distinct)
+
+	if len(feed.recent) > boilerplate.config.window() {
+		for _, text := range feed.recent[0] {
+			if feed.counts[text]--; feed.counts[text] == 0 {
+				delete(feed.counts, text)
+			}
+		}
+		feed.recent = feed.recent[1:]
+	}
+	return feed
+}
+
+// splitSegments splits the body after each line break, keeping the markup, so that the segments join back into the body
+func splitSegments(body string) []string {
+	var segments []string
+	start := 0
+	for _, loc := range boilerplateSegmentEnds.FindAllStringIndex(body, -1) {
+		segments = append(segments, body[start:loc[1]])
+		start = loc[1]
+	}
+	if start < len(body) {
+		segments = append(segments, body[start:])
+	}
+	return segments
+}
+
+// segmentText is the text of a segment, without markup and with spaces collapsed, to compare segments and match patterns
+func segmentText(segment string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(htmlTags.ReplaceAllString(segment, ""))), " ")
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package xpd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const boilerplateTestFooter = "<p>You received this message because you are subscribed to the group.</p>"
+
+func Test_boilerplate_learns_lines_recurring_in_a_feed(t *testing.T) {
+	boilerplate, err := newBoilerplate(BoilerplateConfig{MinPosts: 3}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gg := &Feed{Id: "gg"}
+
+	var stripped Post
+	for i := 1; i <= 3; i++ {
+		stripped = boilerplate.strip(Post{Id: fmt.Sprint(i), Body: fmt.Sprintf("<p>question %d</p>\n%s", i, boilerplateTestFooter), Feed: gg})
+	}
+	if stripped.Body != "<p>question 3</p>\n" {
+		t.Fatalf("got %q; expected the footer removed from the third post", stripped.Body)
+	}
+
+	// in another feed, the footer is not boilerplate yet
+	other := boilerplate.strip(Post{Id: "4", Body: "<p>question 4</p>" + boilerplateTestFooter, Feed: &Feed{Id: "so"}})
+	if !strings.Contains(other.Body, "You received") {
+		t.Fatalf("got %q; expected the footer kept in another feed", other.Body)
+	}
+}
+
+func Test_boilerplate_forgets_lines_out_of_the_window(t *testing.T) {
+	boilerplate, err := newBoilerplate(BoilerplateConfig{MinPosts: 2, Window: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gg := &Feed{Id: "gg"}
+
+	boilerplate.strip(Post{Body: "a\nfooter", Feed: gg})
+	boilerplate.strip(Post{Body: "b", Feed: gg})
+	boilerplate.strip(Post{Body: "c", Feed: gg})
+	if post := boilerplate.strip(Post{Body: "d\nfooter", Feed: gg}); post.Body != "d\nfooter" {
+		t.Fatalf("got %q; expected the footer of a post out of the window forgotten", post.Body)
+	}
+}
+
+func Test_boilerplate_ignorePatterns(t *testing.T) {
+	feeds := []Feed{{Id: "so", IgnorePatterns: []string{"^(?i)possible duplicate:"}}}
+	boilerplate, err := newBoilerplate(BoilerplateConfig{Disabled: true}, feeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := boilerplate.strip(Post{Body: "<p>Possible Duplicate: <a href='x'>other</a></p><p>how to?</p>", Feed: &feeds[0]})
+	if post.Body != "<p>how to?</p>" {
+		t.Fatalf("got %q; expected the line matching the pattern removed", post.Body)
+	}
+
+	// nothing would remain
+	post = boilerplate.strip(Post{Body: "possible duplicate: x", Feed: &feeds[0]})
+	if post.Body != "possible duplicate: x" {
+		t.Fatalf("got %q; expected the post unchanged", post.Body)
+	}
+
+	if _, err := newBoilerplate(BoilerplateConfig{}, []Feed{{Id: "so", IgnorePatterns: []string{"("}}}); err == nil {
+		t.Fatal("got success; expected an invalid pattern rejected")
+	}
+}
+
+func Test_processNewPost_detects_without_boilerplate(t *testing.T) {
+	feeds := []Feed{{Id: "so"}, {Id: "gg", IgnorePatterns: []string{"^You received this message"}}}
+	boilerplate, err := newBoilerplate(BoilerplateConfig{}, feeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := NewEventStore()
+	ctx := context.Background()
+	context := &Context{
+		Detectors:      []Detector{SameBodyDetector{}},
+		Listeners:      []Listener{events},
+		PostRepository: NewPostRepository(),
+		boilerplate:    boilerplate,
+	}
+
+	processNewPost(ctx, context, Post{Id: "1", Body: "<p>how to?</p>", Feed: &feeds[0]})
+	processNewPost(ctx, context, Post{Id: "2", Body: "<p>how to?</p>" + boilerplateTestFooter, Feed: &feeds[1]})
+
+	if recent := events.FindRecent(); len(recent) != 1 || recent[0].Post.Id != "2" {
+		t.Fatalf("got %#v; expected the cross-post found without the footer", recent)
+	}
+}
+
+func Test_parseConfig_invalid_ignorePattern(t *testing.T) {
+	content := strings.Replace(configTestValid, "    url: http://stackoverflow.com/feeds\n", "    url: http://stackoverflow.com/feeds\n    ignorePatterns:\n      - \"(\"\n", 1)
+	_, err := parseConfig("xpd.yml", []byte(content))
+	if err == nil || !strings.HasPrefix(err.Error(), "xpd.yml:5:7: invalid ignore pattern: (") {
+		t.Fatalf("got %v; expected the invalid pattern reported at its position", err)
+	}
+}
+
+func Test_admitPost_keeps_posts_as_fetched(t *testing.T) {
+	newContext := func(repo PostRepository) *Context {
+		boilerplate, err := newBoilerplate(BoilerplateConfig{MinPosts: 3}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Context{PostRepository: repo, boilerplate: boilerplate}
+	}
+	gg := &Feed{Id: "gg"}
+	context := newContext(NewPostRepository())
+	post := func(i int) Post {
+		return Post{Id: fmt.Sprint(i), Body: fmt.Sprintf("question number %d\n%s", i, boilerplateTestFooter), Feed: gg}
+	}
+	for i := 1; i <= 7; i++ {
+		admitPost(context, post(i))
+	}
+
+	stored, _ := context.PostRepository.Get("gg", "6")
+	if stored.Body != post(6).Body || stored.stripped != "question number 6\n" {
+		t.Fatalf("got %#v; expected the post stored as fetched, compared without the footer", stored)
+	}
+
+	// after a restart, the boilerplate learned is lost
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "posts.json")
+	if err := savePosts(context.PostRepository, path); err != nil {
+		t.Fatal(err)
+	}
+	restarted := newContext(NewPostRepository())
+	if err := loadPosts(restarted.PostRepository, path, []Feed{*gg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := admitPost(restarted, post(6)); ok {
+		t.Fatal("got the unchanged post detected again; expected it ignored")
+	}
+	if loaded, _ := restarted.PostRepository.Get("gg", "6"); loaded.stripped != "question number 6\n" {
+		t.Fatalf("got %#v; expected the stripped body loaded", loaded)
+	}
+}
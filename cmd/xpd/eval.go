@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/xpd-org/xpd"
+	"os"
+)
+
+// eval evaluates the configured detectors on a labeled dataset, and returns the exit status
+func eval(args []string) int {
+	flags := flag.NewFlagSet("eval", flag.ExitOnError)
+	configfile := flags.String("config", defaultConfigFile, "path to configuration file, with the detectors to evaluate")
+	dataset := flags.String("dataset", "", "path to the labeled dataset of posts, in JSONL format")
+	sweep := flags.String("sweep", "", "param of detectors to evaluate with each of the values, like maxDiffRatio=0.05,0.1,0.2")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 || *dataset == "" {
+		flags.Usage()
+		return 2
+	}
+
+	if err := xpd.Eval(*configfile, *dataset, *sweep, os.Stdout); err != nil {
+		fmt.Println("error:", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/xpd-org/xpd"
+	"os"
+)
+
+// explain shows why the configured detectors consider two posts similar or not, and returns the exit status
+func explain(args []string) int {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	configfile := flags.String("config", defaultConfigFile, "path to configuration file, with the detectors and the repository file")
+	flags.Usage = func() {
+		fmt.Printf("Usage: %s explain [-config file] first second\n\n", os.Args[0])
+		fmt.Println("Compares the first post with the second, like a new post with an older one.")
+		fmt.Println("Posts are ids of posts in the repository file, paths of files, or URLs to fetch.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := xpd.Explain(*configfile, flags.Arg(0), flags.Arg(1), os.Stdout); err != nil {
+		fmt.Println("error:", err)
+		return 1
+	}
+	return 0
+}
@@ -17,28 +17,58 @@ func exit() {
 
 type Params struct {
 	configfile string
+	configdir  string
+	httpaddr   string
 }
 
 func parseArgs() Params {
 	flag.Usage = func() {
-		fmt.Printf("Usage: %s [options]\n\n", os.Args[0])
+		fmt.Printf("Usage: %s [options]\n", os.Args[0])
+		fmt.Printf("       %s run [-config file] [-once] [-backfill] [-record dir | -replay dir]\n", os.Args[0])
+		fmt.Printf("       %s eval [-config file] -dataset file [-sweep param=values]\n", os.Args[0])
+		fmt.Printf("       %s explain [-config file] first second\n", os.Args[0])
+		fmt.Printf("       %s suppress [-config file] (list | add ... | remove id...)\n", os.Args[0])
+		fmt.Printf("       %s validate [config files]\n\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 
 	configfilePtr := flag.String("config", defaultConfigFile, "path to configuration file")
+	configdirPtr := flag.String("config-dir", "", "path to a directory of configuration files (*.yml), to run as separate projects")
+	httpaddrPtr := flag.String("http", "", "address to serve the status of all projects on, with -config-dir")
 	flag.Parse()
 
 	if len(flag.Args()) != 0 {
 		exit()
 	}
 
-	return Params{*configfilePtr}
+	return Params{*configfilePtr, *configdirPtr, *httpaddrPtr}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "eval":
+			os.Exit(eval(os.Args[2:]))
+		case "explain":
+			os.Exit(explain(os.Args[2:]))
+		case "run":
+			os.Exit(run(os.Args[2:]))
+		case "suppress":
+			os.Exit(suppress(os.Args[2:]))
+		case "validate":
+			os.Exit(validate(os.Args[2:]))
+		}
+	}
+
 	params := parseArgs()
 
-	if err := xpd.RunForever(params.configfile); err != nil {
+	var err error
+	if params.configdir != "" {
+		err = xpd.RunSupervisor(params.configdir, params.httpaddr)
+	} else {
+		err = xpd.RunForever(params.configfile)
+	}
+	if err != nil {
 		fmt.Println("error:", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/xpd-org/xpd"
+)
+
+// run runs the configuration, until stopped or once, and returns the exit status
+func run(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	configfile := flags.String("config", defaultConfigFile, "path to configuration file")
+	once := flags.Bool("once", false, "fetch every feed once, process the new posts, and exit; with status 1 if a feed could not be fetched")
+	backfill := flags.Bool("backfill", false, "add the posts already in the feeds to the repository, without notifying listeners")
+	record := flags.String("record", "", "save the fetched feeds to this directory, to replay later")
+	replay := flags.String("replay", "", "process the feeds recorded in this directory, in order, instead of fetching, and exit")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := xpd.Run(*configfile, xpd.RunOptions{Once: *once, Backfill: *backfill, Record: *record, Replay: *replay}); err != nil {
+		fmt.Println("error:", err)
+		return 1
+	}
+	return 0
+}
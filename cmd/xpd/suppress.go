@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/xpd-org/xpd"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// suppress lists, adds and removes the suppressions of the configured file, and returns the exit status
+func suppress(args []string) int {
+	flags := flag.NewFlagSet("suppress", flag.ExitOnError)
+	configfile := flags.String("config", defaultConfigFile, "path to configuration file, with the suppressions file")
+	flags.Usage = func() {
+		fmt.Printf("Usage: %s suppress [-config file] list\n", os.Args[0])
+		fmt.Printf("       %s suppress [-config file] add (-pair feed:id,feed:id | -cluster feed:id,feed:id,... | -author name | -subject regexp | -feeds id,id) [-for duration] [-reason text]\n", os.Args[0])
+		fmt.Printf("       %s suppress [-config file] remove id...\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	config, err := xpd.ParseConfig(*configfile)
+	if err != nil {
+		fmt.Println("error:", err)
+		return 1
+	}
+	if config.Suppressions.File == "" {
+		fmt.Println("error: configure suppressions.file")
+		return 1
+	}
+	store, err := xpd.OpenSuppressionStore(config.Suppressions.File)
+	if err != nil {
+		fmt.Println("error:", err)
+		return 1
+	}
+
+	switch flags.Arg(0) {
+	case "list":
+		err = listSuppressions(store)
+	case "add":
+		err = addSuppression(store, flags.Args()[1:])
+	case "remove":
+		err = removeSuppressions(store, flags.Args()[1:])
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Println("error:", err)
+		return 1
+	}
+	return 0
+}
+
+func listSuppressions(store *xpd.SuppressionStore) error {
+	suppressions, err := store.List()
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tKIND\tMATCHES\tEXPIRES\tREASON")
+	for _, suppression := range suppressions {
+		posts := make([]string, len(suppression.Posts))
+		for i, post := range suppression.Posts {
+			posts[i] = post.Feed + ":" + post.Id
+		}
+		matches := strings.Join(posts, ",") + suppression.Author + suppression.Subject + strings.Join(suppression.Feeds, ",")
+		expires := "never"
+		if suppression.Expires != nil {
+			expires = suppression.Expires.Format(time.RFC3339)
+		}
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\n", suppression.Id, suppression.Kind, matches, expires, suppression.Reason)
+	}
+	return table.Flush()
+}
+
+func addSuppression(store *xpd.SuppressionStore, args []string) error {
+	flags := flag.NewFlagSet("suppress add", flag.ExitOnError)
+	pair := flags.String("pair", "", "two posts as feed:id, separated by a comma, not to report as matching each other")
+	cluster := flags.String("cluster", "", "posts as feed:id, separated by commas, not to report as matching each other")
+	author := flags.String("author", "", "author whose posts are not to be reported as matching")
+	subject := flags.String("subject", "", "regular expression of the subjects of posts not to be reported as matching")
+	feeds := flags.String("feeds", "", "ids of two feeds, separated by a comma, whose posts are not to be reported as matching each other")
+	duration := flags.Duration("for", 0, "time after which the suppression expires, like 720h; never if 0")
+	reason := flags.String("reason", "", "why the matches are not to be reported, for the record")
+	flags.Parse(args)
+
+	suppression := xpd.Suppression{Reason: *reason}
+	kinds := 0
+	for kind, value := range map[xpd.SuppressionKind]string{
+		xpd.SuppressPair: *pair, xpd.SuppressCluster: *cluster, xpd.SuppressAuthor: *author, xpd.SuppressSubject: *subject,
+		xpd.SuppressFeeds: *feeds,
+	} {
+		if value == "" {
+			continue
+		}
+		kinds++
+		suppression.Kind = kind
+		switch kind {
+		case xpd.SuppressPair, xpd.SuppressCluster:
+			suppression.Posts = parseSuppressedPosts(value)
+		case xpd.SuppressAuthor:
+			suppression.Author = value
+		case xpd.SuppressSubject:
+			suppression.Subject = value
+		case xpd.SuppressFeeds:
+			suppression.Feeds = strings.Split(value, ",")
+		}
+	}
+	if kinds != 1 || flags.NArg() != 0 {
+		return errors.New("expected exactly one of -pair, -cluster, -author, -subject or -feeds")
+	}
+	if *duration > 0 {
+		expires := time.Now().Add(*duration)
+		suppression.Expires = &expires
+	}
+
+	added, err := store.Add(suppression)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("added suppression %d\n", added.Id)
+	return nil
+}
+
+func removeSuppressions(store *xpd.SuppressionStore, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected the ids of the suppressions to remove")
+	}
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid id: %s", arg)
+		}
+		if err := store.Remove(id); err != nil {
+			return err
+		}
+		fmt.Printf("removed suppression %d\n", id)
+	}
+	return nil
+}
+
+// parseSuppressedPosts parses posts like feed:id, separated by commas; the ids may contain colons, like URLs
+func parseSuppressedPosts(value string) []xpd.SuppressedPost {
+	var posts []xpd.SuppressedPost
+	for _, item := range strings.Split(value, ",") {
+		var post xpd.SuppressedPost
+		if i := strings.Index(item, ":"); i >= 0 {
+			post.Feed, post.Id = item[:i], item[i+1:]
+		}
+		posts = append(posts, post)
+	}
+	return posts
+}
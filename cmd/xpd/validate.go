@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"github.com/xpd-org/xpd"
+)
+
+// validate checks configuration files, by default xpd.yml,
+// printing all the errors found, and returns the exit status
+func validate(paths []string) int {
+	if len(paths) == 0 {
+		paths = []string{defaultConfigFile}
+	}
+
+	status := 0
+	for _, path := range paths {
+		if _, err := xpd.ParseConfig(path); err != nil {
+			fmt.Println(err)
+			status = 1
+		} else {
+			fmt.Println(path + ": ok")
+		}
+	}
+	return status
+}
@@ -0,0 +1,374 @@
+package xpd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xpd-org/xpd/secret"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const defaultCommentTemplate = `This was also posted at:
+{{range .Posts}}- {{.Url}}
+{{end}}`
+
+const defaultCommentInterval = time.Minute
+
+const stackExchangeApiUrl = "https://api.stackexchange.com/2.2"
+
+// Commenter posts comments on a site that supports it
+type Commenter interface {
+	// Supports tells if the post is on the site of this commenter
+	Supports(Post) bool
+	Comment(ctx context.Context, post Post, text string) error
+}
+
+// CommentListener comments on the newer post of a cross-post,
+// linking to the other copies, at most once per post
+type CommentListener struct {
+	Commenters []Commenter
+	DryRun     bool
+	template   *template.Template
+	interval   time.Duration
+	record     *commentRecord
+	mutex      sync.Mutex
+	last       time.Time
+}
+
+func NewCommentListener(params map[string]string) (*CommentListener, error) {
+	listener := &CommentListener{
+		DryRun:   params["dryRun"] == "true",
+		interval: defaultCommentInterval,
+	}
+
+	text := defaultCommentTemplate
+	if s, ok := params["template"]; ok {
+		text = s
+	}
+	tmpl, err := template.New("comment").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("comment: invalid template: %s", err)
+	}
+	listener.template = tmpl
+
+	if s, ok := params["interval"]; ok {
+		interval, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("comment: invalid interval: %s", err)
+		}
+		listener.interval = interval
+	}
+
+	if key, token := params["stackExchangeKey"], params["stackExchangeToken"]; key != "" || token != "" {
+		listener.Commenters = append(listener.Commenters, &StackExchangeCommenter{
+			apiUrl: stackExchangeApiUrl,
+			Key:    key,
+			Token:  secret.Value(token),
+		})
+	}
+	if base := params["discourseUrl"]; base != "" {
+		listener.Commenters = append(listener.Commenters, &DiscourseCommenter{
+			Url:         strings.TrimSuffix(base, "/"),
+			ApiKey:      secret.Value(params["discourseApiKey"]),
+			ApiUsername: params["discourseApiUsername"],
+		})
+	}
+	if len(listener.Commenters) == 0 {
+		return nil, errors.New("comment: configure stackExchangeKey and stackExchangeToken, or discourseUrl")
+	}
+
+	record, err := loadCommentRecord(params["recordFile"])
+	if err != nil {
+		return nil, err
+	}
+	listener.record = record
+
+	return listener, nil
+}
+
+func (listener *CommentListener) OnCrossPost(ctx context.Context, post Post, posts []Post) error {
+	commenter := listener.commenterFor(post)
+	if commenter == nil {
+		return nil
+	}
+
+	cluster := clusterKey(post, posts)
+	if listener.record.contains(postKey(post), cluster) {
+		log.Println("already commented on:", post.Id)
+		return nil
+	}
+
+	var text bytes.Buffer
+	if err := listener.template.Execute(&text, struct {
+		Post  Post
+		Posts []Post
+	}{post, posts}); err != nil {
+		return err
+	}
+
+	if listener.DryRun {
+		log.Printf("dry run: would comment on %s:\n%s", post.Url, text.String())
+		listener.record.add(postKey(post), cluster, false)
+		return nil
+	}
+
+	if err := listener.waitForTurn(ctx); err != nil {
+		return err
+	}
+
+	log.Println("commenting on:", post.Url)
+	if err := commenter.Comment(ctx, post, text.String()); err != nil {
+		return err
+	}
+	return listener.record.add(postKey(post), cluster, true)
+}
+
+// only cross-posts are commented
+func (listener *CommentListener) OnDuplicate(ctx context.Context, post Post, posts []Post) error {
+	return nil
+}
+
+func (listener *CommentListener) commenterFor(post Post) Commenter {
+	for _, commenter := range listener.Commenters {
+		if commenter.Supports(post) {
+			return commenter
+		}
+	}
+	return nil
+}
+
+// rate limit comments to one per interval
+func (listener *CommentListener) waitForTurn(ctx context.Context) error {
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+	if wait := listener.last.Add(listener.interval).Sub(time.Now()); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	listener.last = time.Now()
+	return nil
+}
+
+func (listener *CommentListener) String() string {
+	return fmt.Sprintf("comment(dryRun=%t, interval=%s, %d site(s))", listener.DryRun, listener.interval, len(listener.Commenters))
+}
+
+// clusterKey identifies the set of posts of a cross-post, regardless of their order
+func clusterKey(post Post, posts []Post) string {
+	keys := newEvent(CrossPostEvent, post, posts).postKeys()
+	sort.Strings(keys)
+	return strings.Join(keys, "|")
+}
+
+// commentRecord is the set of posts already commented on, and of their cross-posts,
+// appended to a file to remember them across restarts
+type commentRecord struct {
+	path     string
+	mutex    sync.Mutex
+	posts    map[string]bool
+	clusters map[string]bool
+}
+
+type commentRecordEntry struct {
+	Time    time.Time `json:"time"`
+	Post    string    `json:"post"`
+	Cluster string    `json:"cluster"`
+}
+
+func loadCommentRecord(path string) (*commentRecord, error) {
+	record := &commentRecord{path: path, posts: make(map[string]bool), clusters: make(map[string]bool)}
+	if path == "" {
+		return record, nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return record, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry commentRecordEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("comment: malformed record file %s: %s", path, err)
+		}
+		record.posts[entry.Post] = true
+		if entry.Cluster != "" {
+			record.clusters[entry.Cluster] = true
+		}
+	}
+	return record, scanner.Err()
+}
+
+// contains tells if the post, or another post of the same cross-post, was commented on
+func (record *commentRecord) contains(key, cluster string) bool {
+	record.mutex.Lock()
+	defer record.mutex.Unlock()
+	return record.posts[key] || record.clusters[cluster]
+}
+
+func (record *commentRecord) add(key, cluster string, persist bool) error {
+	record.mutex.Lock()
+	defer record.mutex.Unlock()
+	record.posts[key] = true
+	record.clusters[cluster] = true
+
+	if !persist || record.path == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(commentRecordEntry{Time: time.Now(), Post: key, Cluster: cluster})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(record.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+var commentHttpClient = &http.Client{Timeout: 30 * time.Second}
+
+// StackExchangeCommenter comments on questions of Stack Exchange sites,
+// using an access token with write_access scope
+type StackExchangeCommenter struct {
+	apiUrl string
+	Key    string
+	Token  secret.Value
+}
+
+// matches URLs like https://stackoverflow.com/questions/123/title and http://superuser.com/q/123
+var stackExchangePostUrl = regexp.MustCompile(`^https?://([a-z.]+)/(?:questions|q|a)/(\d+)`)
+
+func (commenter *StackExchangeCommenter) Supports(post Post) bool {
+	_, _, ok := parseStackExchangeUrl(post.Url)
+	return ok
+}
+
+func parseStackExchangeUrl(postUrl string) (site, id string, ok bool) {
+	m := stackExchangePostUrl.FindStringSubmatch(postUrl)
+	if m == nil {
+		return "", "", false
+	}
+	host := m[1]
+	switch {
+	case strings.HasSuffix(host, ".stackexchange.com"):
+		site = strings.TrimSuffix(host, ".stackexchange.com")
+	case host == "stackoverflow.com", host == "superuser.com", host == "serverfault.com", host == "askubuntu.com":
+		site = strings.TrimSuffix(host, ".com")
+	default:
+		return "", "", false
+	}
+	return site, m[2], true
+}
+
+func (commenter *StackExchangeCommenter) Comment(ctx context.Context, post Post, text string) error {
+	site, id, ok := parseStackExchangeUrl(post.Url)
+	if !ok {
+		return fmt.Errorf("not a Stack Exchange post: %s", post.Url)
+	}
+
+	form := url.Values{
+		"site":         {site},
+		"key":          {commenter.Key},
+		"access_token": {string(commenter.Token)},
+		"body":         {text},
+	}
+	return postForm(ctx, commenter.apiUrl+"/posts/"+id+"/comments/add", form, nil)
+}
+
+func (commenter *StackExchangeCommenter) String() string {
+	return "StackExchangeCommenter"
+}
+
+// DiscourseCommenter replies to topics of a Discourse forum
+type DiscourseCommenter struct {
+	Url         string
+	ApiKey      secret.Value
+	ApiUsername string
+}
+
+// matches topic URLs like /t/some-slug/123 and /t/123, optionally followed by a post number
+var discourseTopicPath = regexp.MustCompile(`^/t/(?:[^/]+/)?(\d+)(?:/\d+)?/?$`)
+
+func (commenter *DiscourseCommenter) Supports(post Post) bool {
+	_, ok := commenter.topicId(post)
+	return ok
+}
+
+func (commenter *DiscourseCommenter) topicId(post Post) (string, bool) {
+	if !strings.HasPrefix(post.Url, commenter.Url+"/") {
+		return "", false
+	}
+	m := discourseTopicPath.FindStringSubmatch(strings.TrimPrefix(post.Url, commenter.Url))
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+func (commenter *DiscourseCommenter) Comment(ctx context.Context, post Post, text string) error {
+	topicId, ok := commenter.topicId(post)
+	if !ok {
+		return fmt.Errorf("not a topic of %s: %s", commenter.Url, post.Url)
+	}
+
+	form := url.Values{
+		"topic_id": {topicId},
+		"raw":      {text},
+	}
+	headers := map[string]string{
+		"Api-Key":      string(commenter.ApiKey),
+		"Api-Username": commenter.ApiUsername,
+	}
+	return postForm(ctx, commenter.Url+"/posts.json", form, headers)
+}
+
+func (commenter *DiscourseCommenter) String() string {
+	return "DiscourseCommenter(" + commenter.Url + ")"
+}
+
+func postForm(ctx context.Context, uri string, form url.Values, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := commentHttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s: %s", uri, resp.Status, body)
+	}
+	return nil
+}
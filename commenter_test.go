@@ -0,0 +1,230 @@
+package xpd
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type mockCommenter struct {
+	comments map[string]string
+}
+
+func (commenter *mockCommenter) Supports(post Post) bool {
+	return strings.HasPrefix(post.Url, "http://mock/")
+}
+
+func (commenter *mockCommenter) Comment(ctx context.Context, post Post, text string) error {
+	commenter.comments[post.Url] = text
+	return nil
+}
+
+func Test_NewCommentListener_validates_params(t *testing.T) {
+	invalid := []map[string]string{
+		{},
+		{"discourseUrl": "http://forum", "template": "{{"},
+		{"discourseUrl": "http://forum", "interval": "soon"},
+	}
+	for _, params := range invalid {
+		if _, err := NewCommentListener(params); err == nil {
+			t.Errorf("got success; expected invalid params to fail: %#v", params)
+		}
+	}
+}
+
+func Test_CommentListener_comments_once_per_post(t *testing.T) {
+	listener, _ := NewCommentListener(map[string]string{"discourseUrl": "http://unused"})
+	commenter := &mockCommenter{comments: make(map[string]string)}
+	listener.Commenters, listener.interval = []Commenter{commenter}, 0
+	old := Post{Id: "1", Url: "http://elsewhere/1", Feed: &Feed{Id: "gg"}}
+	post := Post{Id: "2", Url: "http://mock/2", Feed: &Feed{Id: "so"}}
+
+	if err := listener.OnCrossPost(context.Background(), post, []Post{old}); err != nil {
+		t.Fatal(err)
+	}
+	if text := commenter.comments[post.Url]; !strings.Contains(text, old.Url) {
+		t.Fatalf("got comment %#v; expected link to %s", text, old.Url)
+	}
+
+	delete(commenter.comments, post.Url)
+	listener.OnCrossPost(context.Background(), post, []Post{old})
+	if len(commenter.comments) != 0 {
+		t.Fatal("got second comment; expected to comment only once")
+	}
+}
+
+func Test_CommentListener_comments_once_per_cross_post(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	params := map[string]string{"discourseUrl": "http://unused", "recordFile": filepath.Join(dir, "commented.jsonl")}
+
+	// both supported
+	old := Post{Id: "1", Url: "http://mock/1", Feed: &Feed{Id: "gg"}}
+	post := Post{Id: "2", Url: "http://mock/2", Feed: &Feed{Id: "so"}}
+
+	listener, _ := NewCommentListener(params)
+	commenter := &mockCommenter{comments: make(map[string]string)}
+	listener.Commenters, listener.interval = []Commenter{commenter}, 0
+	listener.OnCrossPost(context.Background(), post, []Post{old})
+	listener.OnCrossPost(context.Background(), old, []Post{post})
+	if _, ok := commenter.comments[old.Url]; ok || len(commenter.comments) != 1 {
+		t.Fatalf("got comments %#v; expected only the first post of the cross-post commented", commenter.comments)
+	}
+
+	restarted, _ := NewCommentListener(params)
+	commenter = &mockCommenter{comments: make(map[string]string)}
+	restarted.Commenters, restarted.interval = []Commenter{commenter}, 0
+	restarted.OnCrossPost(context.Background(), old, []Post{post})
+	if len(commenter.comments) != 0 {
+		t.Fatal("got comment after restart; expected the record of the cross-post to prevent it")
+	}
+}
+
+func Test_CommentListener_ignores_unsupported_and_duplicates(t *testing.T) {
+	listener, _ := NewCommentListener(map[string]string{"discourseUrl": "http://unused"})
+	commenter := &mockCommenter{comments: make(map[string]string)}
+	listener.Commenters, listener.interval = []Commenter{commenter}, 0
+	old := Post{Id: "1", Url: "http://elsewhere/1", Feed: &Feed{Id: "gg"}}
+	post := Post{Id: "2", Url: "http://mock/2", Feed: &Feed{Id: "so"}}
+
+	listener.OnCrossPost(context.Background(), old, []Post{post})
+	listener.OnDuplicate(context.Background(), post, []Post{old})
+	if len(commenter.comments) != 0 {
+		t.Fatalf("got comments %#v; expected none", commenter.comments)
+	}
+}
+
+func Test_CommentListener_dry_run(t *testing.T) {
+	listener, _ := NewCommentListener(map[string]string{"discourseUrl": "http://unused", "dryRun": "true"})
+	commenter := &mockCommenter{comments: make(map[string]string)}
+	listener.Commenters, listener.interval = []Commenter{commenter}, 0
+	old := Post{Id: "1", Url: "http://elsewhere/1", Feed: &Feed{Id: "gg"}}
+	post := Post{Id: "2", Url: "http://mock/2", Feed: &Feed{Id: "so"}}
+
+	listener.OnCrossPost(context.Background(), post, []Post{old})
+	if len(commenter.comments) != 0 {
+		t.Fatal("got comment; expected none in dry run")
+	}
+}
+
+func Test_CommentListener_custom_template(t *testing.T) {
+	listener, _ := NewCommentListener(map[string]string{"discourseUrl": "http://unused", "template": "see {{(index .Posts 0).Id}}"})
+	commenter := &mockCommenter{comments: make(map[string]string)}
+	listener.Commenters, listener.interval = []Commenter{commenter}, 0
+	old := Post{Id: "1", Url: "http://elsewhere/1", Feed: &Feed{Id: "gg"}}
+	post := Post{Id: "2", Url: "http://mock/2", Feed: &Feed{Id: "so"}}
+
+	listener.OnCrossPost(context.Background(), post, []Post{old})
+	if actual, expected := commenter.comments[post.Url], "see 1"; actual != expected {
+		t.Fatalf("got comment %#v; expected %#v", actual, expected)
+	}
+}
+
+func Test_CommentListener_record_survives_restart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	params := map[string]string{"discourseUrl": "http://unused", "recordFile": filepath.Join(dir, "commented.jsonl")}
+
+	old := Post{Id: "1", Url: "http://elsewhere/1", Feed: &Feed{Id: "gg"}}
+	post := Post{Id: "2", Url: "http://mock/2", Feed: &Feed{Id: "so"}}
+
+	listener, _ := NewCommentListener(params)
+	listener.Commenters, listener.interval = []Commenter{&mockCommenter{comments: make(map[string]string)}}, 0
+	listener.OnCrossPost(context.Background(), post, []Post{old})
+
+	restarted, _ := NewCommentListener(params)
+	commenter := &mockCommenter{comments: make(map[string]string)}
+	restarted.Commenters, restarted.interval = []Commenter{commenter}, 0
+	restarted.OnCrossPost(context.Background(), post, []Post{old})
+	if len(commenter.comments) != 0 {
+		t.Fatal("got comment after restart; expected the record to prevent it")
+	}
+}
+
+func Test_parseStackExchangeUrl(t *testing.T) {
+	valid := map[string][2]string{
+		"http://stackoverflow.com/questions/123/some-title": {"stackoverflow", "123"},
+		"https://stackoverflow.com/q/456":                   {"stackoverflow", "456"},
+		"https://unix.stackexchange.com/questions/789/x":    {"unix", "789"},
+	}
+	for postUrl, expected := range valid {
+		site, id, ok := parseStackExchangeUrl(postUrl)
+		if !ok || site != expected[0] || id != expected[1] {
+			t.Errorf("got %s, %s, %t for %s; expected %v", site, id, ok, postUrl, expected)
+		}
+	}
+
+	for _, postUrl := range []string{"https://groups.google.com/d/msg/x/1", "https://example.com/questions/1"} {
+		if _, _, ok := parseStackExchangeUrl(postUrl); ok {
+			t.Errorf("got %s supported; expected not a Stack Exchange post", postUrl)
+		}
+	}
+}
+
+func Test_StackExchangeCommenter_Comment(t *testing.T) {
+	var form map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/posts/123/comments/add" {
+			http.NotFound(w, r)
+			return
+		}
+		r.ParseForm()
+		form = r.PostForm
+	}))
+	defer server.Close()
+
+	commenter := &StackExchangeCommenter{apiUrl: server.URL, Key: "key", Token: "token"}
+	if err := commenter.Comment(context.Background(), Post{Url: "http://stackoverflow.com/questions/123/x"}, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if form["site"][0] != "stackoverflow" || form["body"][0] != "hello" || form["access_token"][0] != "token" {
+		t.Fatalf("got form %#v; expected site, body and token", form)
+	}
+}
+
+func Test_DiscourseCommenter_Comment(t *testing.T) {
+	var topicId, apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		topicId = r.PostForm.Get("topic_id")
+		apiKey = r.Header.Get("Api-Key")
+		if r.URL.Path != "/posts.json" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	commenter := &DiscourseCommenter{Url: server.URL, ApiKey: "secret", ApiUsername: "bot"}
+	post := Post{Url: server.URL + "/t/some-topic/42/3"}
+	if !commenter.Supports(post) {
+		t.Fatalf("got %s not supported; expected a topic url", post.Url)
+	}
+	if err := commenter.Comment(context.Background(), post, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if topicId != "42" || apiKey != "secret" {
+		t.Fatalf("got topic_id=%s, Api-Key=%s; expected 42 and the api key", topicId, apiKey)
+	}
+
+	if commenter.Supports(Post{Url: "http://elsewhere/t/x/1"}) {
+		t.Fatal("got other forum supported; expected only urls of the configured forum")
+	}
+}
+
+func Test_parseListeners_comment(t *testing.T) {
+	config := ListenerConfig{TypeConfig: TypeConfig{Type: "comment", Params: map[string]string{"discourseUrl": "http://forum"}}}
+	if _, err := parseListeners([]ListenerConfig{config}, DispatchConfig{}, nil); err != nil {
+		t.Fatalf("got error: %s; expected successful parsing of comment listener", err)
+	}
+}
@@ -0,0 +1,355 @@
+package xpd
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigError is a problem at a position of a configuration file.
+// Line and Column start at 1, and are 0 when unknown.
+type ConfigError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (err ConfigError) Error() string {
+	switch {
+	case err.Line == 0:
+		return fmt.Sprintf("%s: %s", err.File, err.Message)
+	case err.Column == 0:
+		return fmt.Sprintf("%s:%d: %s", err.File, err.Line, err.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", err.File, err.Line, err.Column, err.Message)
+}
+
+// ConfigErrors are all the problems found in a configuration file, in order of position
+type ConfigErrors []ConfigError
+
+func (errs ConfigErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// configParams lists the params supported by a type of detector or listener,
+// to keep in sync with parseDetectors and parseListener
+type configParams struct {
+	required []string
+	optional []string
+	// params that must be http or https URLs
+	urls []string
+}
+
+func (params configParams) supports(name string) bool {
+	for _, known := range append(params.required, params.optional...) {
+		if known == name {
+			return true
+		}
+	}
+	return false
+}
+
+var detectorParams = map[string]configParams{
+	"SameBodyDetector":         {},
+	"SimilarWordCountDetector": {optional: []string{"maxDiffRatio"}},
+}
+
+var listenerParams = map[string]configParams{
+	"gmail": {
+		required: []string{"from", "pass", "recipient"},
+		optional: []string{"subject"},
+	},
+	"comment": {
+		optional: []string{"stackExchangeKey", "stackExchangeToken", "discourseUrl", "discourseApiKey", "discourseApiUsername",
+			"template", "interval", "recordFile", "dryRun"},
+		urls: []string{"discourseUrl"},
+	},
+	"exec": {
+		required: []string{"command"},
+		optional: []string{"timeout", "concurrency"},
+	},
+	"jsonl": {
+		required: []string{"path"},
+		optional: []string{"maxSize", "maxBackups"},
+	},
+}
+
+// parseConfig decodes a configuration strictly, rejecting unknown keys,
+// and validates it, returning all the problems found as ConfigErrors
+func parseConfig(path string, content []byte) (*Config, error) {
+	validator := &configValidator{file: path, lines: splitConfigLines(content)}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(content, &config); err != nil {
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			// malformed YAML, nothing more to validate
+			validator.addYamlError(err.Error())
+			return nil, validator.errs
+		}
+		for _, message := range typeErr.Errors {
+			validator.addYamlError(message)
+		}
+	}
+	config.path = path
+
+	validator.validate(&config)
+	if len(validator.errs) > 0 {
+		sort.SliceStable(validator.errs, func(i, j int) bool {
+			a, b := validator.errs[i], validator.errs[j]
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		})
+		return nil, validator.errs
+	}
+	return &config, nil
+}
+
+type configValidator struct {
+	file  string
+	lines []configLine
+	errs  ConfigErrors
+}
+
+var yamlErrorPattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+var yamlUnknownFieldPattern = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+
+// addYamlError adds an error of the YAML decoder, like "line 3: field foo not found in type xpd.Config"
+func (validator *configValidator) addYamlError(message string) {
+	m := yamlErrorPattern.FindStringSubmatch(message)
+	if m == nil {
+		validator.errs = append(validator.errs, ConfigError{File: validator.file, Message: message})
+		return
+	}
+	line, _ := strconv.Atoi(m[1])
+	err := ConfigError{File: validator.file, Line: line, Message: m[2]}
+	if field := yamlUnknownFieldPattern.FindStringSubmatch(m[2]); field != nil {
+		err.Message = "unknown key: " + field[1]
+		for _, l := range validator.lines {
+			if l.number == line && l.isKey(field[1]) {
+				err.Column = l.indent + 1
+			}
+		}
+	}
+	validator.errs = append(validator.errs, err)
+}
+
+// add adds an error at the position of the entry at the given path, like "listeners", "0", "params"
+func (validator *configValidator) add(message string, path ...string) {
+	line, column := locateConfigPath(validator.lines, path)
+	validator.errs = append(validator.errs, ConfigError{File: validator.file, Line: line, Column: column, Message: message})
+}
+
+func (validator *configValidator) validate(config *Config) {
+	if len(config.Feeds) == 0 {
+		validator.add("configure at least one feed", "feeds")
+	}
+	ids := make(map[string]bool)
+	for i, feed := range config.Feeds {
+		index := strconv.Itoa(i)
+		if feed.Id == "" {
+			validator.add("missing feed id", "feeds", index)
+		} else if ids[feed.Id] {
+			validator.add("duplicate feed id: "+feed.Id, "feeds", index, "id")
+		}
+		ids[feed.Id] = true
+		if feed.Url == "" {
+			validator.add("missing feed url", "feeds", index)
+		} else if uri, err := interpolate(feed.Url); err != nil {
+			validator.add(err.Error(), "feeds", index, "url")
+		} else if !isHttpUrl(uri) {
+			validator.add("invalid url, expected http:// or https://: "+feed.Url, "feeds", index, "url")
+		}
+		for j, pattern := range feed.IgnorePatterns {
+			if _, err := compileIgnorePattern(pattern); err != nil {
+				validator.add(err.Error(), "feeds", index, "ignorePatterns", strconv.Itoa(j))
+			}
+		}
+	}
+
+	if _, err := interpolate(string(config.HTTP.Token)); err != nil {
+		validator.add(err.Error(), "http", "token")
+	}
+
+	if len(config.Detectors) == 0 {
+		validator.add("configure at least one detector", "detectors")
+	}
+	for i, item := range config.Detectors {
+		path := []string{"detectors", strconv.Itoa(i)}
+		if validator.validateParams("detector", detectorParams, item, path) {
+			if _, err := parseDetector(item); err != nil {
+				validator.add(err.Error(), path...)
+			}
+		}
+	}
+
+	for i, item := range config.Listeners {
+		path := []string{"listeners", strconv.Itoa(i)}
+		if validator.validateParams("listener", listenerParams, item.TypeConfig, path) {
+			if _, err := parseListener(item.TypeConfig); err != nil {
+				validator.add(err.Error(), path...)
+			}
+		}
+		if item.Filter != nil {
+			if _, err := NewEventFilter(*item.Filter); err != nil {
+				validator.add(err.Error(), append(path, "filter")...)
+			}
+		}
+		if item.Digest != nil {
+			if _, err := item.Digest.validate(); err != nil {
+				validator.add(err.Error(), append(path, "digest")...)
+			}
+		}
+	}
+}
+
+// validateParams checks the type and params of a detector or listener,
+// returning true if they are worth validating further by constructing it
+func (validator *configValidator) validateParams(kind string, types map[string]configParams, config TypeConfig, path []string) bool {
+	params, ok := types[config.Type]
+	if !ok {
+		if config.Type == "" {
+			validator.add("missing "+kind+" type", path...)
+		} else {
+			validator.add(fmt.Sprintf("unsupported %s type: %s", kind, config.Type), append(path, "type")...)
+		}
+		return false
+	}
+
+	valid := true
+	var names []string
+	for name := range config.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !params.supports(name) {
+			validator.add(fmt.Sprintf("unknown param of %s: %s", config.Type, name), append(path, "params", name)...)
+			valid = false
+		}
+	}
+	for _, name := range params.required {
+		if config.Params[name] == "" {
+			validator.add(fmt.Sprintf("missing param of %s: %s", config.Type, name), path...)
+			valid = false
+		}
+	}
+	urls := make(map[string]bool)
+	for _, name := range params.urls {
+		urls[name] = true
+	}
+	for _, name := range names {
+		value, err := interpolate(config.Params[name])
+		if err != nil {
+			validator.add(fmt.Sprintf("param %s: %s", name, err), append(path, "params", name)...)
+			valid = false
+		} else if urls[name] && value != "" && !isHttpUrl(value) {
+			validator.add(fmt.Sprintf("invalid url, expected http:// or https://: %s", config.Params[name]), append(path, "params", name)...)
+			valid = false
+		}
+	}
+	return valid
+}
+
+func isHttpUrl(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// configLine is a line of a YAML file, with the text after the indentation.
+// Sequence items like "- key: value" are split into a line "-" and a line "key: value",
+// so that the entries of items are found like the entries of mappings.
+type configLine struct {
+	number int
+	indent int
+	text   string
+}
+
+func (line configLine) isKey(key string) bool {
+	return strings.HasPrefix(line.text, key+":")
+}
+
+func splitConfigLines(content []byte) []configLine {
+	var lines []configLine
+	for i, s := range strings.Split(string(content), "\n") {
+		text := strings.TrimLeft(s, " ")
+		indent := len(s) - len(text)
+		for {
+			text = strings.TrimRight(text, " \r")
+			if text == "" || strings.HasPrefix(text, "#") {
+				break
+			}
+			if text != "-" && !strings.HasPrefix(text, "- ") {
+				lines = append(lines, configLine{number: i + 1, indent: indent, text: text})
+				break
+			}
+			lines = append(lines, configLine{number: i + 1, indent: indent, text: "-"})
+			rest := strings.TrimLeft(text[1:], " ")
+			indent += len(text) - len(rest)
+			text = rest
+		}
+	}
+	return lines
+}
+
+// locateConfigPath returns the line and column of the entry at the given path,
+// like "listeners", "0", "params", or of its closest parent found.
+// Only block style is supported: entries inside flow style like "[{id: a}]" are located at their parent.
+func locateConfigPath(lines []configLine, path []string) (line, column int) {
+	scope := lines
+	for _, segment := range path {
+		if len(scope) == 0 {
+			return
+		}
+		indent := scope[0].indent
+		found := -1
+		if index, err := strconv.Atoi(segment); err == nil {
+			for i, l := range scope {
+				if l.indent == indent && l.text == "-" {
+					if index == 0 {
+						found = i
+						break
+					}
+					index--
+				}
+			}
+		} else {
+			for i, l := range scope {
+				if l.indent == indent && l.isKey(segment) {
+					found = i
+					break
+				}
+			}
+		}
+		if found < 0 {
+			return
+		}
+		entry := scope[found]
+		line, column = entry.number, entry.indent+1
+		scope = nestedConfigLines(scope[found+1:], entry)
+	}
+	return
+}
+
+// nestedConfigLines returns the lines nested under the entry, from the start of the given lines
+func nestedConfigLines(lines []configLine, entry configLine) []configLine {
+	end := 0
+	for ; end < len(lines); end++ {
+		l := lines[end]
+		// the items of a sequence may be at the same indentation as its key
+		nested := l.indent > entry.indent || l.indent == entry.indent && l.text == "-" && entry.text != "-"
+		if !nested {
+			break
+		}
+	}
+	return lines[:end]
+}
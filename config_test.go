@@ -0,0 +1,119 @@
+package xpd
+
+import (
+	"strings"
+	"testing"
+)
+
+const configTestValid = `feeds:
+  - id: so
+    url: http://stackoverflow.com/feeds
+detectors:
+  - type: SimilarWordCountDetector
+    params:
+      maxDiffRatio: 0.2
+listeners:
+  - type: jsonl
+    params:
+      path: events.jsonl
+    digest:
+      every: 1h
+`
+
+func Test_parseConfig_valid(t *testing.T) {
+	config, err := parseConfig("xpd.yml", []byte(configTestValid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Feeds) != 1 || config.Detectors[0].Params["maxDiffRatio"] != "0.2" || config.Listeners[0].Digest == nil {
+		t.Fatalf("got %#v; expected the configuration decoded", config)
+	}
+}
+
+func Test_parseConfig_reports_all_errors_with_positions(t *testing.T) {
+	content := `feeds:
+  - id: so
+    url: stackoverflow.com/feeds
+  - url: http://localhost/gg
+    idd: gg
+detectors:
+- type: SimilarWordCountDetector
+  params:
+    maxDifRatio: 0.2
+- type: Nonexistent
+listeners:
+  - type: gmail
+    params:
+      from: me
+      subject: hello
+  - type: exec
+    params:
+      command: cat
+    filter:
+      kinds: [triple-post]
+shutdownTimeout: 1m
+shutdownTimout: 1m
+`
+	_, err := parseConfig("xpd.yml", []byte(content))
+	errs, ok := err.(ConfigErrors)
+	if !ok {
+		t.Fatalf("got %#v; expected ConfigErrors", err)
+	}
+
+	expected := []string{
+		"xpd.yml:3:5: invalid url, expected http:// or https://: stackoverflow.com/feeds",
+		"xpd.yml:4:3: missing feed id",
+		"xpd.yml:5:5: unknown key: idd",
+		"xpd.yml:9:5: unknown param of SimilarWordCountDetector: maxDifRatio",
+		"xpd.yml:10:3: unsupported detector type: Nonexistent",
+		"xpd.yml:12:3: missing param of gmail: pass",
+		"xpd.yml:12:3: missing param of gmail: recipient",
+		"xpd.yml:19:5: filter: unsupported event kind: triple-post",
+		"xpd.yml:22:1: unknown key: shutdownTimout",
+	}
+	if actual := errs.Error(); actual != strings.Join(expected, "\n") {
+		t.Fatalf("got:\n%s\nexpected:\n%s", actual, strings.Join(expected, "\n"))
+	}
+}
+
+func Test_parseConfig_malformed(t *testing.T) {
+	_, err := parseConfig("xpd.yml", []byte("feeds:\n  - id: so\n   url: x\n"))
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 1 || errs[0].Line == 0 {
+		t.Fatalf("got %#v; expected a single error with its line", err)
+	}
+}
+
+func Test_parseConfig_flow_style_located_at_parent(t *testing.T) {
+	_, err := parseConfig("xpd.yml", []byte("feeds: [{id: so}]\ndetectors: [{type: SameBodyDetector}]\n"))
+	if err == nil || err.Error() != "xpd.yml:1:1: missing feed url" {
+		t.Fatalf("got %v; expected the error at the feeds", err)
+	}
+}
+
+func Test_locateConfigPath(t *testing.T) {
+	lines := splitConfigLines([]byte(`# comment
+a:
+  b:
+  - c: 1
+    d: 2
+  -   - e
+      - f: 3
+g: 4
+`))
+	for _, example := range []struct {
+		path         []string
+		line, column int
+	}{
+		{[]string{"a"}, 2, 1},
+		{[]string{"a", "b", "0", "d"}, 5, 5},
+		{[]string{"a", "b", "1", "1", "f"}, 7, 9},
+		{[]string{"a", "b", "2"}, 3, 3},
+		{[]string{"g"}, 8, 1},
+		{[]string{"nonexistent"}, 0, 0},
+	} {
+		if line, column := locateConfigPath(lines, example.path); line != example.line || column != example.column {
+			t.Errorf("got %d:%d; expected %d:%d for %v", line, column, example.line, example.column, example.path)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package xpd
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// number of recent events and posts to show on the dashboard
+const dashboardListSize = 50
+
+// dashboard serves HTML pages about the feeds, posts and events of a Context
+type dashboard struct {
+	context *Context
+	refresh time.Duration
+}
+
+type dashboardFeed struct {
+	FeedStatus
+	Stored int
+}
+
+type dashboardComparison struct {
+	Post Post
+	Rows []diffRow
+}
+
+var dashboardFuncs = template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Format("2006-01-02 15:04:05")
+	},
+	"seconds": func(d time.Duration) int {
+		return int(d.Seconds())
+	},
+}
+
+var dashboardLayout = `{{define "header"}}<!doctype html>
+<html>
+<head>
+<meta http-equiv="refresh" content="{{seconds .Refresh}}">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.5em; text-align: left; vertical-align: top; }
+.error { color: #b00; }
+.ok { color: #080; }
+.diff td { font-family: monospace; white-space: pre-wrap; width: 50%; }
+.diff .changed { background: #ffd; }
+.diff .removed { background: #fdd; }
+.diff .added { background: #dfd; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{end}}
+{{define "footer"}}
+<p>Generated at {{time .Now}}, refreshed every {{.Refresh}}.</p>
+</body>
+</html>
+{{end}}`
+
+var dashboardIndex = template.Must(template.New("index").Funcs(dashboardFuncs).Parse(dashboardLayout + `
+{{template "header" .}}
+<h2>Feeds</h2>
+<table>
+<tr><th>Feed</th><th>Status</th><th>Last fetch</th><th>Fetches</th><th>Errors</th><th>New posts</th><th>Stored posts</th></tr>
+{{range .Feeds}}
+<tr>
+<td><a href="{{.Feed.Url}}">{{.Feed.Id}}</a></td>
+<td>{{if .Healthy}}<span class="ok">ok</span>{{else if .Fetches}}<span class="error" title="{{time .LastErrorTime}}">{{.LastError}}</span>{{else}}waiting{{end}}</td>
+<td>{{time .LastFetch}}</td>
+<td>{{.Fetches}}</td>
+<td>{{.Errors}}</td>
+<td>{{.Posts}}</td>
+<td>{{.Stored}}</td>
+</tr>
+{{end}}
+</table>
+
+<h2>Recent duplicates and cross-posts</h2>
+{{if .Events}}
+<table>
+<tr><th>Time</th><th>Kind</th><th>Detector</th><th>Score</th><th>Post</th><th>Matches</th></tr>
+{{range .Events}}
+<tr>
+<td><a href="events/{{.Id}}">{{time .Time}}</a></td>
+<td>{{.Kind}}</td>
+<td>{{.Detector}}</td>
+<td>{{printf "%.2f" .Score}}</td>
+<td>{{.Post.Feed.Id}}: <a href="{{.Post.Url}}">{{.Post.Subject}}</a></td>
+<td>{{range .Posts}}{{.Feed.Id}}: <a href="{{.Url}}">{{.Subject}}</a><br>{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>None yet.</p>
+{{end}}
+
+<h2>Recent posts</h2>
+<table>
+<tr><th>Feed</th><th>Author</th><th>Subject</th></tr>
+{{range .Posts}}
+<tr><td>{{.Feed.Id}}</td><td>{{.Author}}</td><td><a href="{{.Url}}">{{.Subject}}</a></td></tr>
+{{end}}
+</table>
+{{template "footer" .}}
+`))
+
+var dashboardEvent = template.Must(template.New("event").Funcs(dashboardFuncs).Parse(dashboardLayout + `
+{{template "header" .}}
+<p><a href="../">&larr; back</a></p>
+<p>
+Possible {{.Event.Kind}} found by {{.Event.Detector}} with score {{printf "%.2f" .Event.Score}} at {{time .Event.Time}}:
+{{.Event.Post.Feed.Id}}: <a href="{{.Event.Post.Url}}">{{.Event.Post.Subject}}</a>
+by {{.Event.Post.Author}}
+</p>
+{{$post := .Event.Post}}
+{{range .Comparisons}}
+<h2>of {{.Post.Feed.Id}}: <a href="{{.Post.Url}}">{{.Post.Subject}}</a> by {{.Post.Author}}</h2>
+<table class="diff">
+<tr><th>{{.Post.Feed.Id}} (older)</th><th>{{$post.Feed.Id}} (new)</th></tr>
+{{range .Rows}}<tr class="{{.Op}}"><td>{{.Left}}</td><td>{{.Right}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{template "footer" .}}
+`))
+
+func (dashboard *dashboard) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	recent := dashboard.context.PostRepository.FindRecent()
+
+	stored := make(map[string]int)
+	for _, post := range recent {
+		stored[post.Feed.Id]++
+	}
+
+	var feeds []dashboardFeed
+	for _, status := range dashboard.context.Monitor.Statuses() {
+		feeds = append(feeds, dashboardFeed{FeedStatus: status, Stored: stored[status.Feed.Id]})
+	}
+
+	var events []StoredEvent
+	all := dashboard.context.Events.FindRecent()
+	for i := len(all) - 1; i >= 0 && len(events) < dashboardListSize; i-- {
+		events = append(events, all[i])
+	}
+
+	var posts []Post
+	for i := len(recent) - 1; i >= 0 && len(posts) < dashboardListSize; i-- {
+		posts = append(posts, recent[i])
+	}
+
+	dashboard.render(w, dashboardIndex, map[string]interface{}{
+		"Title":  "Cross-Post Detector",
+		"Feeds":  feeds,
+		"Events": events,
+		"Posts":  posts,
+	})
+}
+
+func (dashboard *dashboard) event(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/events/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	event, ok := dashboard.context.Events.Find(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	postLines := plainText(event.Post.Body)
+	comparisons := make([]dashboardComparison, len(event.Posts))
+	for i, other := range event.Posts {
+		comparisons[i] = dashboardComparison{
+			Post: other,
+			Rows: diffLines(plainText(other.Body), postLines),
+		}
+	}
+
+	dashboard.render(w, dashboardEvent, map[string]interface{}{
+		"Title":       "Possible " + string(event.Kind) + ": " + event.Post.Subject,
+		"Event":       event,
+		"Comparisons": comparisons,
+	})
+}
+
+func (dashboard *dashboard) render(w http.ResponseWriter, tmpl *template.Template, data map[string]interface{}) {
+	data["Now"] = time.Now()
+	data["Refresh"] = dashboard.refresh
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("error: dashboard: %s", err)
+	}
+}
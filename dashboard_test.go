@@ -0,0 +1,75 @@
+package xpd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newDashboardTestContext() *Context {
+	monitor := NewFeedMonitor()
+	so := Feed{Id: "so-sonarqube", Url: "http://so"}
+	gg := Feed{Id: "gg-sonarqube", Url: "http://gg"}
+	monitor.record(so, 1, nil)
+	monitor.add(gg)
+
+	repo := NewPostRepository()
+	old := Post{Id: "1", Subject: "old subject", Body: "<p>same</p><p>old line</p>", Feed: &so}
+	post := Post{Id: "2", Subject: "new subject", Body: "<p>same</p><p>new line</p>", Feed: &gg}
+	repo.Add(old)
+	repo.Add(post)
+
+	events := NewEventStore()
+	events.OnCrossPost(context.Background(), post, []Post{old})
+
+	return &Context{PostRepository: repo, Monitor: monitor, Events: events}
+}
+
+func get(t *testing.T, context *Context, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewServeMux(context, HTTPConfig{}).ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_dashboard_index(t *testing.T) {
+	recorder := get(t, newDashboardTestContext(), "/")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d; expected 200", recorder.Code)
+	}
+
+	body := recorder.Body.String()
+	for _, expected := range []string{"so-sonarqube", "gg-sonarqube", "waiting", "new subject", `href="events/1"`, `content="60"`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("got page without %#v", expected)
+		}
+	}
+}
+
+func Test_dashboard_event_shows_diff(t *testing.T) {
+	recorder := get(t, newDashboardTestContext(), "/events/1")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d; expected 200", recorder.Code)
+	}
+
+	body := recorder.Body.String()
+	for _, expected := range []string{`<tr class="same"><td>same</td><td>same</td></tr>`, `<tr class="changed"><td>old line</td><td>new line</td></tr>`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("got page without %#v:\n%s", expected, body)
+		}
+	}
+}
+
+func Test_dashboard_not_found(t *testing.T) {
+	context := newDashboardTestContext()
+	for _, path := range []string{"/nonexistent", "/events/2", "/events/x"} {
+		if recorder := get(t, context, path); recorder.Code != http.StatusNotFound {
+			t.Errorf("got status %d for %s; expected 404", recorder.Code, path)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package xpd
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"sync"
+)
+
+// number of posts of a feed waiting for their detection before the main loop waits
+const detectionQueueSize = 100
+
+// detection is the search of the matches of an admitted post,
+// with the posts to compare it with, taken when it was admitted
+type detection struct {
+	post Post
+	// the posts admitted before the post, without those of its thread,
+	// or all the other posts if the post was edited
+	recent []Post
+	// the post before its edit, nil if the post is new
+	previous *Post
+}
+
+// admitPost strips the boilerplate and quotes of the post for the detectors, takes the posts to compare it with,
+// and adds it to the repository as fetched, returning false if there is nothing to detect.
+// Posts are admitted one by one, in the order they are fetched, so that whatever the order their detections run in,
+// each post is compared with all the posts admitted before it, and the newer of two matching posts is the one reported.
+// Posts fetched again, for example after a restart with a repository file, are edited if their content changed.
+func admitPost(context *Context, post Post) (detection, bool) {
+	repo := context.PostRepository
+	previous, seen := repo.Get(post.feedId(), post.Id)
+	if seen && post.Subject == previous.Subject && post.Body == previous.Body {
+		log.Printf("ignoring post %s fetched again without changes", post.Id)
+		return detection{}, false
+	}
+	post.Edited = seen
+	post.stripped = ""
+	if stripped := stripQuotes(context.boilerplate.strip(post)); stripped.Body != post.Body {
+		post.stripped = stripped.Body
+	}
+	metrics := context.Metrics
+
+	if !seen {
+		metrics.Add("xpd_posts_ingested_total", 1, post.feedId())
+		recent := excludeThread(post, repo.FindRecent())
+		repo.Add(post)
+		return detection{post: post, recent: recent}, true
+	}
+
+	metrics.Add("xpd_posts_edited_total", 1, post.feedId())
+	repo.Add(post)
+	key := postKey(post)
+	var others []Post
+	for _, other := range repo.FindRecent() {
+		if postKey(other) != key {
+			others = append(others, other)
+		}
+	}
+	return detection{post: post, recent: excludeThread(post, others), previous: &previous}, true
+}
+
+// run searches the matches of the post, and notifies the listeners.
+// Edited posts are notified if they match posts they did not match before their edit, with events marked as Edited,
+// and with a NoLongerMatchesEvent if they no longer match any of the posts they matched.
+func (detection detection) run(ctx context.Context, context *Context) {
+	post := detection.post.forDetection()
+	recent := make([]Post, len(detection.recent))
+	for i, other := range detection.recent {
+		recent[i] = other.forDetection()
+	}
+	if detection.previous == nil {
+		detector, matches := detect(ctx, context, post, recent)
+		notifyMatches(ctx, context, detector, post, matches, false)
+		return
+	}
+
+	_, before := detect(ctx, context, detection.previous.forDetection(), recent)
+	detector, after := detect(ctx, context, post, recent)
+
+	matchedBefore := make(map[string]bool)
+	for _, match := range before {
+		matchedBefore[postKey(match)] = true
+	}
+	for _, match := range after {
+		if !matchedBefore[postKey(match)] {
+			notifyMatches(ctx, context, detector, post, after, true)
+			return
+		}
+	}
+	if len(before) > 0 && len(after) == 0 {
+		log.Printf("edited post %s no longer matches %d post(s)", post.Id, len(before))
+		notifyListeners(ctx, context, newEvent(NoLongerMatchesEvent, post, before))
+	}
+}
+
+// forDetection returns a copy of the post as compared by the detectors, without boilerplate and quotes
+func (post Post) forDetection() Post {
+	if post.stripped != "" {
+		post.fetched = post.Body
+		post.Body = post.stripped
+	}
+	return post
+}
+
+// asFetched returns the post compared by the detectors as fetched, to notify the listeners
+func (post Post) asFetched() Post {
+	if post.fetched != "" {
+		post.Body = post.fetched
+		post.fetched = ""
+	}
+	return post
+}
+
+// detectionPool runs the detections of the posts of each feed in a goroutine per feed, in the order they are submitted,
+// and the detections of different feeds in parallel, at most as many at a time as there are CPUs
+type detectionPool struct {
+	ctx     context.Context
+	context *Context
+	queues  map[string]chan detection
+	slots   chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newDetectionPool(ctx context.Context, context *Context) *detectionPool {
+	return &detectionPool{
+		ctx:     ctx,
+		context: context,
+		queues:  make(map[string]chan detection),
+		slots:   make(chan struct{}, runtime.GOMAXPROCS(0)),
+	}
+}
+
+// submit queues the detection after the previous detections of the feed of its post,
+// waiting if too many are queued
+func (pool *detectionPool) submit(submitted detection) {
+	feedId := submitted.post.feedId()
+	queue, ok := pool.queues[feedId]
+	if !ok {
+		queue = make(chan detection, detectionQueueSize)
+		pool.queues[feedId] = queue
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for detection := range queue {
+				pool.slots <- struct{}{}
+				detection.run(pool.ctx, pool.context)
+				<-pool.slots
+			}
+		}()
+	}
+	queue <- submitted
+}
+
+// wait waits until all the submitted detections are done
+func (pool *detectionPool) wait() {
+	for feedId, queue := range pool.queues {
+		close(queue)
+		delete(pool.queues, feedId)
+	}
+	pool.wg.Wait()
+}
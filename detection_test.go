@@ -0,0 +1,76 @@
+package xpd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_detectionPool_reports_the_newer_post_of_cross_posts(t *testing.T) {
+	events := NewEventStore()
+	ctx := context.Background()
+	context := &Context{
+		Detectors:      []Detector{SameBodyDetector{}, NewSimilarWordCountDetector(0.05)},
+		Listeners:      []Listener{events},
+		PostRepository: NewPostRepository(),
+	}
+	feeds := []*Feed{{Id: "so"}, {Id: "gg"}, {Id: "ml"}, {Id: "forum"}}
+
+	pool := newDetectionPool(ctx, context)
+	for i := 0; i < 50; i++ {
+		for j, feed := range feeds {
+			// words are letters only
+			topic := strings.Repeat("x", i+1)
+			body := fmt.Sprintf("<p>question about %s of many words, in feed %s</p>", topic, feed.Id)
+			if j == len(feeds)-1 {
+				// a cross-post of the question of the first feed, admitted after it
+				body = fmt.Sprintf("<p>question about %s of many words, in feed %s</p>", topic, feeds[0].Id)
+			}
+			if detection, ok := admitPost(context, Post{Id: fmt.Sprint(i), Body: body, Feed: feed}); ok {
+				pool.submit(detection)
+			}
+		}
+	}
+	pool.wait()
+
+	recent := events.FindRecent()
+	if len(recent) != 50 {
+		t.Fatalf("got %d events; expected one per cross-post", len(recent))
+	}
+	for _, event := range recent {
+		if event.Kind != CrossPostEvent || event.Post.Feed.Id != "forum" || len(event.Posts) != 1 || event.Posts[0].Feed.Id != "so" {
+			t.Fatalf("got %#v; expected the post of the forum reported as cross-post of the older post", event)
+		}
+	}
+	if posts := context.PostRepository.FindRecent(); len(posts) != 200 {
+		t.Fatalf("got %d posts; expected all the posts added", len(posts))
+	}
+}
+
+func Test_detection_concurrent_use(t *testing.T) {
+	detector := NewSimilarWordCountDetector(0.2)
+	repo := newPostRepository(RepositoryConfig{MaxPosts: 50, MaxPostsPerFeed: 20}, NewMetrics())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		feed := &Feed{Id: fmt.Sprint("feed", i)}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				post := Post{Id: fmt.Sprint(j), Body: fmt.Sprintf("post %d of %s", j, feed.Id), Feed: feed}
+				detector.FindDuplicates(context.Background(), post, repo.FindRecent())
+				repo.Add(post)
+				repo.Get(feed.Id, post.Id)
+				bestScore(detector, post, repo.FindRecent())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if posts := repo.FindRecent(); len(posts) != 50 {
+		t.Fatalf("got %d posts; expected the maximum kept", len(posts))
+	}
+}
@@ -1,13 +1,44 @@
 package xpd
 
 import (
+	"context"
+	"fmt"
+	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 )
 
+// detectorName is the name of the detector type, as used in the configuration
+func detectorName(detector Detector) string {
+	t := reflect.TypeOf(detector)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// bestScore is the highest score of similarity of the post to any of the given posts,
+// or 1 if the detector doesn't compute scores
+func bestScore(detector Detector, post Post, posts []Post) float64 {
+	scorer, ok := detector.(Scorer)
+	if !ok {
+		return 1
+	}
+	best := 0.0
+	for _, other := range posts {
+		if score := scorer.Score(post, other); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
 type SameBodyDetector struct{}
 
-func (detector SameBodyDetector) FindDuplicates(post Post, oldPosts []Post) []Post {
+func (detector SameBodyDetector) FindDuplicates(ctx context.Context, post Post, oldPosts []Post) []Post {
 	duplicates := make([]Post, 0)
 	for _, oldPost := range oldPosts {
 		if post.Body == oldPost.Body {
@@ -17,17 +48,41 @@ func (detector SameBodyDetector) FindDuplicates(post Post, oldPosts []Post) []Po
 	return duplicates
 }
 
-type wordCountCache map[string]wordCountMap
+func (detector SameBodyDetector) Score(post, other Post) float64 {
+	if post.Body == other.Body {
+		return 1
+	}
+	return 0
+}
+
+// Explain tells if the bodies are the same
+func (detector SameBodyDetector) Explain(post, other Post) Explanation {
+	return Explanation{Details: []string{
+		fmt.Sprintf("same body: %t (%d and %d characters)", post.Body == other.Body, len(post.Body), len(other.Body)),
+	}}
+}
+
+// wordCountCache keeps the word counts of posts by postKey, with the body they were counted in
+type wordCountCache map[string]cachedWordCountMap
+
+type cachedWordCountMap struct {
+	body string
+	wordCountMap
+}
 
 type SimilarWordCountDetector struct {
 	maxDiffRatio float64
 	indexMap     wordCountCache
+	// guards indexMap, for the detections running in parallel and for other callers, such as the API.
+	// Words are counted without the lock, and the counts are not modified once cached.
+	mutex *sync.RWMutex
 }
 
 func NewSimilarWordCountDetector(maxDiffRatio float64) SimilarWordCountDetector {
 	return SimilarWordCountDetector{
 		maxDiffRatio: maxDiffRatio,
 		indexMap:     make(wordCountCache),
+		mutex:        &sync.RWMutex{},
 	}
 }
 
@@ -57,17 +112,24 @@ func splitToWords(text string) []string {
 }
 
 func (detector SimilarWordCountDetector) getWordCountMap(post Post) wordCountMap {
-	if wcmap, ok := detector.indexMap[post.Id]; ok {
-		return wcmap
+	key := postKey(post)
+	detector.mutex.RLock()
+	cached, ok := detector.indexMap[key]
+	detector.mutex.RUnlock()
+	// counted again if the post was edited
+	if ok && cached.body == post.Body {
+		return cached.wordCountMap
 	}
+
 	wcmap := newWordCountMap(post.Body)
-	detector.indexMap[post.Id] = wcmap
+	detector.mutex.Lock()
+	detector.indexMap[key] = cachedWordCountMap{post.Body, wcmap}
+	detector.mutex.Unlock()
 	return wcmap
 }
 
-func (detector SimilarWordCountDetector) FindDuplicates(post Post, oldPosts []Post) []Post {
+func (detector SimilarWordCountDetector) FindDuplicates(ctx context.Context, post Post, oldPosts []Post) []Post {
 	wcmap := detector.getWordCountMap(post)
-	defer detector.cleanIndex(append(oldPosts, post))
 
 	duplicates := make([]Post, 0)
 	for _, oldPost := range oldPosts {
@@ -79,14 +141,81 @@ func (detector SimilarWordCountDetector) FindDuplicates(post Post, oldPosts []Po
 	return duplicates
 }
 
-func (detector SimilarWordCountDetector) cleanIndex(posts []Post) {
+// Score is the ratio of words that are the same in both posts
+func (detector SimilarWordCountDetector) Score(post, other Post) float64 {
+	first := detector.getWordCountMap(post)
+	second := detector.getWordCountMap(other)
+	total := first.total + second.total
+	if total == 0 {
+		return 1
+	}
+	return 1 - float64(calcWordCountDiffs(first, second))/float64(total)
+}
+
+// Explain shows the counts of words that differ, compared with the limit of differences
+func (detector SimilarWordCountDetector) Explain(post, other Post) Explanation {
+	first := detector.getWordCountMap(post)
+	second := detector.getWordCountMap(other)
+	limit := float64(first.total) * detector.maxDiffRatio
+	explanation := Explanation{
+		Details: []string{
+			fmt.Sprintf("maxDiffRatio: %g", detector.maxDiffRatio),
+			fmt.Sprintf("limit: %.2f (maxDiffRatio of the %d words of the first post)", limit, first.total),
+			fmt.Sprintf("difference of word totals: %d (%d and %d) %s", abs(first.total-second.total),
+				first.total, second.total, compareToLimit(float64(abs(first.total-second.total)), limit)),
+			fmt.Sprintf("word count diffs: %d %s", calcWordCountDiffs(first, second),
+				compareToLimit(float64(calcWordCountDiffs(first, second)), limit)),
+		},
+		Table: [][]string{{"WORD", "FIRST", "SECOND", "DIFF"}},
+	}
+
+	var words []string
+	for word := range first.counts {
+		if first.counts[word] != second.counts[word] {
+			words = append(words, word)
+		}
+	}
+	for word := range second.counts {
+		if _, ok := first.counts[word]; !ok {
+			words = append(words, word)
+		}
+	}
+	diff := func(word string) int {
+		return abs(first.counts[word] - second.counts[word])
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if diff(words[i]) != diff(words[j]) {
+			return diff(words[i]) > diff(words[j])
+		}
+		return words[i] < words[j]
+	})
+	for _, word := range words {
+		explanation.Table = append(explanation.Table, []string{word,
+			strconv.Itoa(first.counts[word]), strconv.Itoa(second.counts[word]), strconv.Itoa(diff(word))})
+	}
+	return explanation
+}
+
+// compareToLimit is like "< 4.20 (similar)", a value being similar if below the limit
+func compareToLimit(value, limit float64) string {
+	if value < limit {
+		return fmt.Sprintf("< %.2f (similar)", limit)
+	}
+	return fmt.Sprintf(">= %.2f (different)", limit)
+}
+
+// pruneIndex removes the counts of the posts other than those of the repository.
+// The counts of the posts being compared are counted again if needed.
+func (detector SimilarWordCountDetector) pruneIndex(posts []Post) {
+	detector.mutex.Lock()
+	defer detector.mutex.Unlock()
 	if len(detector.indexMap) <= len(posts) {
 		return
 	}
 
-	seen := make(map[string]bool)
+	seen := make(map[string]bool, len(posts))
 	for _, post := range posts {
-		seen[post.Id] = true
+		seen[postKey(post)] = true
 	}
 
 	for key := range detector.indexMap {
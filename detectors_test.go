@@ -1,8 +1,10 @@
 package xpd
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_SameBodyDetector_FindDuplicates_finds_same_body(t *testing.T) {
@@ -16,7 +18,7 @@ func Test_SameBodyDetector_FindDuplicates_finds_same_body(t *testing.T) {
 	repo.Add(Post{Body: differentBody})
 
 	var detector Detector = SameBodyDetector{}
-	if !reflect.DeepEqual(detector.FindDuplicates(post, []Post{post}), []Post{post}) {
+	if !reflect.DeepEqual(detector.FindDuplicates(context.Background(), post, []Post{post}), []Post{post}) {
 		t.Fatal("same-body-detector should find only the match")
 	}
 }
@@ -75,7 +77,7 @@ func Test_SimilarWordCountDetector_with_rearranged_words(t *testing.T) {
 	post := Post{Body: "The quick brown fox jumps over the lazy dog"}
 	rearranged := []Post{{Body: "the lazy dog The quick brown fox jumps over"}}
 
-	if !reflect.DeepEqual(NewSimilarWordCountDetector(diffRatio).FindDuplicates(post, rearranged), rearranged) {
+	if !reflect.DeepEqual(NewSimilarWordCountDetector(diffRatio).FindDuplicates(context.Background(), post, rearranged), rearranged) {
 		t.Fatalf("got '%v' not a duplicate of '%v', but it should be", rearranged[0].Body, post.Body)
 	}
 }
@@ -85,7 +87,7 @@ func Test_SimilarWordCountDetector_with_deleted_words(t *testing.T) {
 	post := Post{Body: "The quick brown fox jumps over the lazy dog filler filler"}
 	deleted := []Post{{Body: "The quick brown fox over the lazy dog filler filler"}}
 
-	if !reflect.DeepEqual(NewSimilarWordCountDetector(diffRatio).FindDuplicates(post, deleted), deleted) {
+	if !reflect.DeepEqual(NewSimilarWordCountDetector(diffRatio).FindDuplicates(context.Background(), post, deleted), deleted) {
 		t.Fatalf("got '%v' not a duplicate of '%v', but it should be", deleted[0].Body, post.Body)
 	}
 }
@@ -95,7 +97,7 @@ func Test_SimilarWordCountDetector_with_added_words(t *testing.T) {
 	post := Post{Body: "The quick brown fox jumps over the lazy dog filler filler"}
 	added := []Post{{Body: "The quick brown fox jumps over the dumb lazy dog filler filler"}}
 
-	if !reflect.DeepEqual(NewSimilarWordCountDetector(diffRatio).FindDuplicates(post, added), added) {
+	if !reflect.DeepEqual(NewSimilarWordCountDetector(diffRatio).FindDuplicates(context.Background(), post, added), added) {
 		t.Fatalf("got '%v' not a duplicate of '%v', but it should be", added[0].Body, post.Body)
 	}
 }
@@ -106,17 +108,17 @@ func Test_SimilarWordCountDetector_index_growth(t *testing.T) {
 	post1 := Post{Id: "1"}
 	post2 := Post{Id: "2"}
 
-	detector.FindDuplicates(post1, []Post{})
+	detector.FindDuplicates(context.Background(), post1, []Post{})
 	if actual := len(detector.indexMap); actual != 1 {
 		t.Fatalf("got %d items in index cache; expected %d", actual, 1)
 	}
 
-	detector.FindDuplicates(post2, []Post{post1})
+	detector.FindDuplicates(context.Background(), post2, []Post{post1})
 	if actual := len(detector.indexMap); actual != 2 {
 		t.Fatalf("got %d items in index cache; expected %d", actual, 2)
 	}
 
-	detector.FindDuplicates(post2, []Post{post1})
+	detector.FindDuplicates(context.Background(), post2, []Post{post1})
 	if actual := len(detector.indexMap); actual != 2 {
 		t.Fatalf("got %d items in index cache; expected %d (unchanged)", actual, 2)
 	}
@@ -129,24 +131,91 @@ func Test_SimilarWordCountDetector_drop_unused_index(t *testing.T) {
 	post2 := Post{Id: "2"}
 	post3 := Post{Id: "3"}
 
-	detector.FindDuplicates(post1, []Post{})
+	detector.FindDuplicates(context.Background(), post1, []Post{})
 	if actual := len(detector.indexMap); actual != 1 {
 		t.Fatalf("got %d items in index cache; expected %d", actual, 1)
 	}
 
-	detector.FindDuplicates(post2, []Post{post1})
+	detector.FindDuplicates(context.Background(), post2, []Post{post1})
 	if actual := len(detector.indexMap); actual != 2 {
 		t.Fatalf("got %d items in index cache; expected %d", actual, 2)
 	}
 
-	detector.FindDuplicates(post3, []Post{post2})
+	detector.FindDuplicates(context.Background(), post3, []Post{post2})
+	if actual := len(detector.indexMap); actual != 3 {
+		t.Fatalf("got %d items in index cache; expected %d, until the repository is compacted", actual, 3)
+	}
+
+	repo := NewPostRepository()
+	repo.Add(post2)
+	repo.Add(post3)
+	compactRepository(&Context{Detectors: []Detector{detector}, PostRepository: repo}, time.Now())
 	if actual := len(detector.indexMap); actual != 2 {
 		t.Fatalf("got %d items in index cache; expected %d", actual, 2)
 	}
-	if _, ok := detector.indexMap[post2.Id]; !ok {
+	if _, ok := detector.indexMap[postKey(post2)]; !ok {
 		t.Fatalf("got post %s not in index, but it should be", post2.Id)
 	}
-	if _, ok := detector.indexMap[post3.Id]; !ok {
+	if _, ok := detector.indexMap[postKey(post3)]; !ok {
 		t.Fatalf("got post %s not in index, but it should be", post3.Id)
 	}
 }
+
+func Test_detectorName(t *testing.T) {
+	if actual, expected := detectorName(SameBodyDetector{}), "SameBodyDetector"; actual != expected {
+		t.Errorf("got %s; expected %s", actual, expected)
+	}
+	if actual, expected := detectorName(&SameBodyDetector{}), "SameBodyDetector"; actual != expected {
+		t.Errorf("got %s; expected %s", actual, expected)
+	}
+}
+
+func Test_SameBodyDetector_Score(t *testing.T) {
+	detector := SameBodyDetector{}
+	if score := detector.Score(Post{Body: "a"}, Post{Body: "a"}); score != 1 {
+		t.Errorf("got score %f; expected 1 for same body", score)
+	}
+	if score := detector.Score(Post{Body: "a"}, Post{Body: "b"}); score != 0 {
+		t.Errorf("got score %f; expected 0 for different body", score)
+	}
+}
+
+func Test_SimilarWordCountDetector_Score(t *testing.T) {
+	detector := NewSimilarWordCountDetector(0.1)
+	post := Post{Id: "1", Body: "one two three four five"}
+
+	if score := detector.Score(post, Post{Id: "2", Body: "five four three two one"}); score != 1 {
+		t.Errorf("got score %f; expected 1 for rearranged words", score)
+	}
+	if score := detector.Score(post, Post{Id: "3", Body: "one two three four six"}); score != 0.8 {
+		t.Errorf("got score %f; expected 0.8 for 1 of 5 words different", score)
+	}
+}
+
+func Test_bestScore(t *testing.T) {
+	post := Post{Body: "a"}
+	if score := bestScore(SameBodyDetector{}, post, []Post{{Body: "b"}, post}); score != 1 {
+		t.Errorf("got score %f; expected the best score 1", score)
+	}
+	if score := bestScore(nonScoringDetector{}, post, []Post{{Body: "b"}}); score != 1 {
+		t.Errorf("got score %f; expected 1 for detector without scores", score)
+	}
+}
+
+type nonScoringDetector struct{}
+
+func (detector nonScoringDetector) FindDuplicates(ctx context.Context, post Post, posts []Post) []Post {
+	return posts
+}
+
+func Test_SimilarWordCountDetector_counts_edited_posts_again(t *testing.T) {
+	detector := NewSimilarWordCountDetector(0.1)
+	so, gg := &Feed{Id: "so"}, &Feed{Id: "gg"}
+	question := "how to configure the quality gate"
+
+	detector.FindDuplicates(context.Background(), Post{Id: "1", Body: "draft", Feed: so}, []Post{})
+	other := Post{Id: "1", Body: question, Feed: gg}
+	if matches := detector.FindDuplicates(context.Background(), Post{Id: "1", Body: question, Feed: so}, []Post{other}); len(matches) != 1 {
+		t.Fatalf("got %#v; expected the edited post counted again, and not confused with the post of the same id in another feed", matches)
+	}
+}
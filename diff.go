@@ -0,0 +1,104 @@
+package xpd
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// longer texts are compared only up to this number of lines
+const maxDiffLines = 500
+
+type diffOp string
+
+const (
+	diffSame    diffOp = "same"
+	diffChanged diffOp = "changed"
+	diffRemoved diffOp = "removed"
+	diffAdded   diffOp = "added"
+)
+
+// diffRow is a row of a side-by-side diff;
+// Left is empty for added lines, Right is empty for removed lines
+type diffRow struct {
+	Op    diffOp
+	Left  string
+	Right string
+}
+
+var htmlLineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|pre|h[1-6]|blockquote|tr)>`)
+
+var htmlTags = regexp.MustCompile(`<[^>]*>`)
+
+// plainText converts the HTML body of a post to lines of text
+func plainText(body string) []string {
+	text := htmlLineBreaks.ReplaceAllString(body, "\n")
+	text = html.UnescapeString(htmlTags.ReplaceAllString(text, ""))
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > maxDiffLines {
+		lines = lines[:maxDiffLines]
+	}
+	return lines
+}
+
+// diffLines computes a side-by-side diff, based on the longest common subsequence of lines
+func diffLines(left, right []string) []diffRow {
+	// lcs[i][j] is the length of the longest common subsequence of left[i:] and right[j:]
+	lcs := make([][]int, len(left)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(right)+1)
+	}
+	for i := len(left) - 1; i >= 0; i-- {
+		for j := len(right) - 1; j >= 0; j-- {
+			if left[i] == right[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var rows []diffRow
+	var removed, added []string
+	flush := func() {
+		for len(removed) > 0 && len(added) > 0 {
+			rows = append(rows, diffRow{Op: diffChanged, Left: removed[0], Right: added[0]})
+			removed, added = removed[1:], added[1:]
+		}
+		for _, line := range removed {
+			rows = append(rows, diffRow{Op: diffRemoved, Left: line})
+		}
+		for _, line := range added {
+			rows = append(rows, diffRow{Op: diffAdded, Right: line})
+		}
+		removed, added = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < len(left) || j < len(right) {
+		switch {
+		case i < len(left) && j < len(right) && left[i] == right[j]:
+			flush()
+			rows = append(rows, diffRow{Op: diffSame, Left: left[i], Right: right[j]})
+			i++
+			j++
+		case j == len(right) || (i < len(left) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, left[i])
+			i++
+		default:
+			added = append(added, right[j])
+			j++
+		}
+	}
+	flush()
+
+	return rows
+}
@@ -0,0 +1,46 @@
+package xpd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_plainText(t *testing.T) {
+	body := "<p>Hello &amp; welcome</p><p>second<br/>third</p>\n  \n<pre><code>x &lt; 1</code></pre>"
+	expected := []string{"Hello & welcome", "second", "third", "x < 1"}
+	if actual := plainText(body); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("got %#v; expected %#v", actual, expected)
+	}
+}
+
+func Test_diffLines(t *testing.T) {
+	left := []string{"a", "b", "c", "d"}
+	right := []string{"a", "x", "c", "d", "e"}
+
+	expected := []diffRow{
+		{Op: diffSame, Left: "a", Right: "a"},
+		{Op: diffChanged, Left: "b", Right: "x"},
+		{Op: diffSame, Left: "c", Right: "c"},
+		{Op: diffSame, Left: "d", Right: "d"},
+		{Op: diffAdded, Right: "e"},
+	}
+	if actual := diffLines(left, right); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("got %#v; expected %#v", actual, expected)
+	}
+}
+
+func Test_diffLines_removed(t *testing.T) {
+	expected := []diffRow{
+		{Op: diffRemoved, Left: "a"},
+		{Op: diffSame, Left: "b", Right: "b"},
+	}
+	if actual := diffLines([]string{"a", "b"}, []string{"b"}); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("got %#v; expected %#v", actual, expected)
+	}
+}
+
+func Test_diffLines_empty(t *testing.T) {
+	if actual := diffLines(nil, nil); len(actual) != 0 {
+		t.Fatalf("got %#v; expected no rows", actual)
+	}
+}
@@ -0,0 +1,239 @@
+package xpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DigestConfig configures when a digest listener flushes its buffered events:
+// periodically (Every), daily at a given time of day (At, in "15:04" format),
+// and/or when MaxEvents events have accumulated, counting those merged into the same entry.
+type DigestConfig struct {
+	Every     time.Duration `yaml:"every"`
+	At        string        `yaml:"at"`
+	MaxEvents int           `yaml:"maxEvents"`
+}
+
+// DigestReceiver is implemented by listeners that can handle a batch of
+// events at once, for example by sending them in a single email
+type DigestReceiver interface {
+	OnDigest(context.Context, []Event) error
+}
+
+// DigestListener wraps a Listener, buffering events and passing them on
+// in batches, grouped by feeds, and without repeating the same cluster of posts
+type DigestListener struct {
+	Listener Listener
+	config   DigestConfig
+	at       time.Time
+	mutex    sync.Mutex
+	entries  []*digestEntry
+	// the number of events received since the last flush, merged or not
+	received int
+	// closed on shutdown, to stop flushing periodically
+	stop chan struct{}
+}
+
+// a cluster of posts reported by one or more events
+type digestEntry struct {
+	event Event
+	keys  map[string]bool
+}
+
+// validate checks the configuration, returning the parsed time of day of At, if set
+func (config DigestConfig) validate() (at time.Time, err error) {
+	if config.Every < 0 || config.MaxEvents < 0 {
+		return at, errors.New("digest: every and maxEvents must not be negative")
+	}
+	if config.Every > 0 && config.At != "" {
+		return at, errors.New("digest: use either every or at, not both")
+	}
+	if config.At != "" {
+		if at, err = time.Parse("15:04", config.At); err != nil {
+			return at, fmt.Errorf("digest: invalid time of day: %s", config.At)
+		}
+	} else if config.Every == 0 && config.MaxEvents == 0 {
+		return at, errors.New("digest: configure at least one of every, at, maxEvents")
+	}
+	return at, nil
+}
+
+func NewDigestListener(listener Listener, config DigestConfig) (*DigestListener, error) {
+	at, err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+	digest := &DigestListener{Listener: listener, config: config, at: at, stop: make(chan struct{})}
+
+	if config.Every > 0 || config.At != "" {
+		go digest.flushPeriodically()
+	}
+
+	return digest, nil
+}
+
+func (digest *DigestListener) OnCrossPost(ctx context.Context, post Post, posts []Post) error {
+	return digest.OnEvent(ctx, newEvent(CrossPostEvent, post, posts))
+}
+
+func (digest *DigestListener) OnDuplicate(ctx context.Context, post Post, posts []Post) error {
+	return digest.OnEvent(ctx, newEvent(DuplicateEvent, post, posts))
+}
+
+// OnEvent buffers the event, flushing the digest if it is full.
+// Posts that no longer match are dropped, unless the wrapped listener handles the details of events:
+// digests of other listeners report matches only.
+func (digest *DigestListener) OnEvent(ctx context.Context, event Event) error {
+	if event.Kind == NoLongerMatchesEvent && !handlesEvents(digest.Listener) {
+		return nil
+	}
+
+	digest.mutex.Lock()
+	digest.merge(event)
+	digest.received++
+	full := digest.config.MaxEvents > 0 && digest.received >= digest.config.MaxEvents
+	digest.mutex.Unlock()
+
+	if full {
+		return digest.Flush(ctx)
+	}
+	return nil
+}
+
+// merge the event into the buffered cluster it overlaps with, if any
+func (digest *DigestListener) merge(event Event) {
+	keys := event.postKeys()
+	for _, entry := range digest.entries {
+		// matches are not merged with the posts that no longer match
+		if (entry.event.Kind == NoLongerMatchesEvent) != (event.Kind == NoLongerMatchesEvent) || !entry.overlaps(keys) {
+			continue
+		}
+		for _, post := range append([]Post{event.Post}, event.Posts...) {
+			if key := postKey(post); !entry.keys[key] {
+				entry.keys[key] = true
+				entry.event.Posts = append(entry.event.Posts, post)
+			}
+		}
+		if event.Kind == CrossPostEvent {
+			entry.event.Kind = CrossPostEvent
+		}
+		return
+	}
+
+	set := make(map[string]bool)
+	for _, key := range keys {
+		set[key] = true
+	}
+	// the posts of the event are shared with the other listeners, and appended to when merging
+	event.Posts = append([]Post(nil), event.Posts...)
+	digest.entries = append(digest.entries, &digestEntry{event: event, keys: set})
+}
+
+func (entry *digestEntry) overlaps(keys []string) bool {
+	for _, key := range keys {
+		if entry.keys[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush passes on all buffered events, grouped by the feeds involved.
+// The failure to pass on an event does not hold up the others, the failures are returned together.
+func (digest *DigestListener) Flush(ctx context.Context) error {
+	digest.mutex.Lock()
+	entries := digest.entries
+	digest.entries, digest.received = nil, 0
+	digest.mutex.Unlock()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	events := make([]Event, len(entries))
+	for i, entry := range entries {
+		events[i] = entry.event
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].feedPair() < events[j].feedPair()
+	})
+
+	log.Printf("flushing digest of %d event(s)", len(events))
+
+	if receiver, ok := digest.Listener.(DigestReceiver); ok {
+		return receiver.OnDigest(ctx, events)
+	}
+	var errs []string
+	for _, event := range events {
+		if err := event.notify(ctx, digest.Listener); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (digest *DigestListener) flushPeriodically() {
+	for {
+		now := time.Now()
+		select {
+		case <-time.After(digest.nextFlush(now).Sub(now)):
+		case <-digest.stop:
+			return
+		}
+		if err := digest.Flush(context.Background()); err != nil {
+			log.Printf("error: %v: %s", digest, err)
+		}
+	}
+}
+
+// Shutdown stops flushing periodically, and flushes the buffered events
+func (digest *DigestListener) Shutdown(ctx context.Context) error {
+	digest.mutex.Lock()
+	select {
+	case <-digest.stop:
+	default:
+		close(digest.stop)
+	}
+	digest.mutex.Unlock()
+	return digest.Flush(ctx)
+}
+
+func (digest *DigestListener) nextFlush(now time.Time) time.Time {
+	if digest.config.At == "" {
+		return now.Add(digest.config.Every)
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), digest.at.Hour(), digest.at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (digest *DigestListener) String() string {
+	return fmt.Sprintf("digest(%v, every=%s, at=%s, maxEvents=%d)",
+		digest.Listener, digest.config.Every, digest.config.At, digest.config.MaxEvents)
+}
+
+func (event Event) postKeys() []string {
+	keys := []string{postKey(event.Post)}
+	for _, post := range event.Posts {
+		keys = append(keys, postKey(post))
+	}
+	return keys
+}
+
+// feedPair is the sorted list of distinct feed ids involved in the event
+func (event Event) feedPair() string {
+	ids := event.feedIds()
+	sort.Strings(ids)
+	return strings.Join(ids, ", ")
+}
@@ -0,0 +1,261 @@
+package xpd
+
+import (
+	"context"
+	"errors"
+	"github.com/xpd-org/xpd/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockDigestReceiver struct {
+	mockListener
+	digests [][]Event
+}
+
+func (receiver *mockDigestReceiver) OnDigest(ctx context.Context, events []Event) error {
+	receiver.digests = append(receiver.digests, events)
+	return nil
+}
+
+// fails to pass on cross-posts
+type failingCrossPostListener struct {
+	mockListener
+}
+
+func (listener *failingCrossPostListener) OnCrossPost(context.Context, Post, []Post) error {
+	return errors.New("cross-post failure")
+}
+
+func Test_NewDigestListener_validates_config(t *testing.T) {
+	invalid := []DigestConfig{
+		{},
+		{Every: -time.Hour},
+		{MaxEvents: -1},
+		{Every: time.Hour, At: "09:00"},
+		{At: "9am"},
+	}
+	for _, config := range invalid {
+		if _, err := NewDigestListener(&mockListener{}, config); err == nil {
+			t.Errorf("got success; expected invalid digest config to fail: %#v", config)
+		}
+	}
+
+	if _, err := NewDigestListener(&mockListener{}, DigestConfig{MaxEvents: 10}); err != nil {
+		t.Errorf("got error: %s; expected success with maxEvents only", err)
+	}
+}
+
+func Test_DigestListener_merges_overlapping_clusters(t *testing.T) {
+	so, gg := &Feed{Id: "so"}, &Feed{Id: "gg"}
+	post1, post2, post3 := Post{Id: "1", Feed: so}, Post{Id: "2", Feed: gg}, Post{Id: "3", Feed: so}
+
+	receiver := &mockDigestReceiver{}
+	digest, _ := NewDigestListener(receiver, DigestConfig{MaxEvents: 10})
+
+	digest.OnCrossPost(context.Background(), post2, []Post{post1})
+	digest.OnCrossPost(context.Background(), post2, []Post{post1})
+	digest.OnDuplicate(context.Background(), post3, []Post{post1})
+	digest.Flush(context.Background())
+
+	if len(receiver.digests) != 1 {
+		t.Fatalf("got %d digests; expected 1", len(receiver.digests))
+	}
+	events := receiver.digests[0]
+	if len(events) != 1 {
+		t.Fatalf("got %d events; expected the repeated and overlapping clusters merged into 1", len(events))
+	}
+	if events[0].Kind != CrossPostEvent {
+		t.Errorf("got kind %s; expected %s", events[0].Kind, CrossPostEvent)
+	}
+	if len(events[0].Posts) != 2 {
+		t.Errorf("got %d older posts in cluster; expected 2", len(events[0].Posts))
+	}
+}
+
+func Test_DigestListener_flushes_when_maxEvents_reached(t *testing.T) {
+	so, gg := &Feed{Id: "so"}, &Feed{Id: "gg"}
+	post1, post2, post3 := Post{Id: "1", Feed: so}, Post{Id: "2", Feed: gg}, Post{Id: "3", Feed: so}
+
+	receiver := &mockDigestReceiver{}
+	digest, _ := NewDigestListener(receiver, DigestConfig{MaxEvents: 2})
+
+	digest.OnCrossPost(context.Background(), post2, []Post{post1})
+	if len(receiver.digests) != 0 {
+		t.Fatal("got digest flushed; expected to wait for more events")
+	}
+
+	digest.OnDuplicate(context.Background(), post3, []Post{{Id: "4", Feed: so}})
+	if len(receiver.digests) != 1 {
+		t.Fatalf("got %d digests; expected flush after 2 events", len(receiver.digests))
+	}
+
+	// repeated events are merged, but count
+	digest.OnCrossPost(context.Background(), post2, []Post{post1})
+	digest.OnCrossPost(context.Background(), post2, []Post{post1})
+	if len(receiver.digests) != 2 || len(receiver.digests[1]) != 1 {
+		t.Fatalf("got digests %#v; expected flush after 2 events of the same cluster", receiver.digests)
+	}
+}
+
+func Test_DigestListener_does_not_change_the_posts_of_events(t *testing.T) {
+	so, gg := &Feed{Id: "so"}, &Feed{Id: "gg"}
+	post1, post2, post3 := Post{Id: "1", Feed: so}, Post{Id: "2", Feed: gg}, Post{Id: "3", Feed: so}
+	posts := make([]Post, 1, 2)
+	posts[0] = post1
+
+	digest, _ := NewDigestListener(&mockDigestReceiver{}, DigestConfig{MaxEvents: 10})
+	defer digest.Shutdown(context.Background())
+	digest.OnCrossPost(context.Background(), post2, posts)
+	digest.OnDuplicate(context.Background(), post3, []Post{post1})
+
+	if shared := posts[:2]; shared[1].Id != "" {
+		t.Fatalf("got %#v; expected the posts of the event not appended to", shared)
+	}
+}
+
+func Test_DigestListener_flush_groups_by_feed_pair(t *testing.T) {
+	so, gg := &Feed{Id: "so"}, &Feed{Id: "gg"}
+	post1, post2, post3 := Post{Id: "1", Feed: so}, Post{Id: "2", Feed: gg}, Post{Id: "3", Feed: so}
+	other := Post{Id: "4", Feed: so}
+
+	receiver := &mockDigestReceiver{}
+	digest, _ := NewDigestListener(receiver, DigestConfig{MaxEvents: 10})
+
+	digest.OnDuplicate(context.Background(), post3, []Post{other})
+	digest.OnCrossPost(context.Background(), post2, []Post{post1})
+	digest.Flush(context.Background())
+
+	events := receiver.digests[0]
+	if actual, expected := events[0].feedPair(), "gg, so"; actual != expected {
+		t.Errorf("got feed pair %s first; expected %s", actual, expected)
+	}
+	if actual, expected := events[1].feedPair(), "so"; actual != expected {
+		t.Errorf("got feed pair %s second; expected %s", actual, expected)
+	}
+}
+
+func Test_DigestListener_flush_notifies_plain_listener_per_event(t *testing.T) {
+	post1, post2 := Post{Id: "1", Feed: &Feed{Id: "so"}}, Post{Id: "2", Feed: &Feed{Id: "gg"}}
+
+	listener := &mockListener{}
+	digest, _ := NewDigestListener(listener, DigestConfig{MaxEvents: 10})
+
+	digest.OnCrossPost(context.Background(), post2, []Post{post1})
+	if listener.invokedWithCross {
+		t.Fatal("got listener invoked before flush; expected event buffered")
+	}
+
+	digest.Flush(context.Background())
+	if !listener.invokedWithCross {
+		t.Fatal("got listener not invoked; expected flush to pass on the event")
+	}
+}
+
+func Test_DigestListener_flush_passes_on_events_after_failure(t *testing.T) {
+	so, gg := &Feed{Id: "so"}, &Feed{Id: "gg"}
+	post1, post2, post3 := Post{Id: "1", Feed: so}, Post{Id: "2", Feed: gg}, Post{Id: "3", Feed: so}
+
+	listener := &failingCrossPostListener{}
+	digest, _ := NewDigestListener(listener, DigestConfig{MaxEvents: 10})
+	digest.OnCrossPost(context.Background(), post2, []Post{post1})
+	digest.OnDuplicate(context.Background(), post3, []Post{{Id: "4", Feed: so}})
+
+	if err := digest.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "cross-post failure") {
+		t.Fatalf("got %v; expected the failure returned", err)
+	}
+	if !listener.invokedWithDups {
+		t.Fatal("got the duplicate not passed on; expected the events after the failure passed on")
+	}
+}
+
+func Test_DigestListener_drops_no_longer_matches_unless_handled(t *testing.T) {
+	post1, post2 := Post{Id: "1", Feed: &Feed{Id: "so"}}, Post{Id: "2", Feed: &Feed{Id: "gg"}}
+	event := newEvent(NoLongerMatchesEvent, post2, []Post{post1})
+
+	receiver := &mockDigestReceiver{}
+	digest, _ := NewDigestListener(receiver, DigestConfig{MaxEvents: 10})
+	digest.OnEvent(context.Background(), event)
+	digest.Flush(context.Background())
+	if len(receiver.digests) != 0 {
+		t.Fatalf("got digests %#v; expected the post that no longer matches dropped", receiver.digests)
+	}
+
+	events := NewEventStore()
+	queue := NewQueuedListener(events, DispatchConfig{})
+	digest, _ = NewDigestListener(queue, DigestConfig{MaxEvents: 10})
+	digest.OnEvent(context.Background(), event)
+	digest.Shutdown(context.Background())
+	queue.Shutdown(context.Background())
+	if recent := events.FindRecent(); len(recent) != 1 || recent[0].Kind != NoLongerMatchesEvent {
+		t.Fatalf("got events %#v; expected the post that no longer matches passed on", recent)
+	}
+}
+
+func Test_DigestListener_empty_flush_is_noop(t *testing.T) {
+	receiver := &mockDigestReceiver{}
+	digest, _ := NewDigestListener(receiver, DigestConfig{MaxEvents: 10})
+	digest.Flush(context.Background())
+
+	if len(receiver.digests) != 0 {
+		t.Fatal("got empty digest; expected nothing sent")
+	}
+}
+
+func Test_DigestListener_nextFlush(t *testing.T) {
+	now := time.Date(2016, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	hourly, _ := NewDigestListener(&mockListener{}, DigestConfig{Every: time.Hour})
+	defer hourly.Shutdown(context.Background())
+	if actual, expected := hourly.nextFlush(now), now.Add(time.Hour); !actual.Equal(expected) {
+		t.Errorf("got %s; expected %s", actual, expected)
+	}
+
+	daily, _ := NewDigestListener(&mockListener{}, DigestConfig{At: "09:00"})
+	defer daily.Shutdown(context.Background())
+	if actual, expected := daily.nextFlush(now), time.Date(2016, 3, 2, 9, 0, 0, 0, time.UTC); !actual.Equal(expected) {
+		t.Errorf("got %s; expected %s", actual, expected)
+	}
+
+	evening, _ := NewDigestListener(&mockListener{}, DigestConfig{At: "18:15"})
+	defer evening.Shutdown(context.Background())
+	if actual, expected := evening.nextFlush(now), time.Date(2016, 3, 1, 18, 15, 0, 0, time.UTC); !actual.Equal(expected) {
+		t.Errorf("got %s; expected %s", actual, expected)
+	}
+}
+
+func Test_MailerListener_OnDigest_sends_single_message(t *testing.T) {
+	so, gg := &Feed{Id: "so"}, &Feed{Id: "gg"}
+	post1, post2, post3 := Post{Id: "1", Feed: so}, Post{Id: "2", Feed: gg}, Post{Id: "3", Feed: so}
+
+	mailer := &mail.MockMailer{}
+	listener := MailerListener{Mailer: mailer}
+	listener.OnDigest(context.Background(), []Event{
+		newEvent(CrossPostEvent, post2, []Post{post1}),
+		newEvent(DuplicateEvent, post3, []Post{post1}),
+	})
+
+	for _, expected := range []string{"digest of 2 event(s)", "== gg, so ==", "== so ==", "possible cross-post:", "possible duplicate:"} {
+		if !strings.Contains(mailer.Message, expected) {
+			t.Errorf("got message without %#v:\n%s", expected, mailer.Message)
+		}
+	}
+}
+
+func Test_parseListeners_with_digest(t *testing.T) {
+	config := ListenerConfig{TypeConfig: TypeConfig{Type: "gmail"}, Digest: &DigestConfig{MaxEvents: 5}}
+	listeners, err := parseListeners([]ListenerConfig{config}, DispatchConfig{}, nil)
+	if err != nil {
+		t.Fatalf("got error: %s; expected successful parsing of digest listener", err)
+	}
+	defer shutdownListeners(context.Background(), listeners)
+	if _, ok := listeners[0].(*DigestListener); !ok {
+		t.Fatalf("got %#v; expected a DigestListener", listeners[0])
+	}
+
+	config.Digest = &DigestConfig{}
+	if _, err := parseListeners([]ListenerConfig{config}, DispatchConfig{}, nil); err == nil {
+		t.Fatal("got success; expected parsing to fail with empty digest config")
+	}
+}
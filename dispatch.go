@@ -0,0 +1,320 @@
+package xpd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultDispatchQueueSize = 100
+
+const defaultDispatchRetries = 3
+
+const defaultDispatchBackoff = 30 * time.Second
+
+// DispatchConfig configures the delivery of events to listeners:
+// each listener gets its own queue of QueueSize, and a failed delivery is retried
+// Retries times, waiting Backoff before the first retry and doubling it after each; never if Retries is 0, 3 times if unset.
+// Events that could not be delivered are appended to DeadLetterFile, if set.
+type DispatchConfig struct {
+	QueueSize      int           `yaml:"queueSize"`
+	Retries        *int          `yaml:"retries"`
+	Backoff        time.Duration `yaml:"backoff"`
+	DeadLetterFile string        `yaml:"deadLetterFile"`
+}
+
+func (config DispatchConfig) withDefaults() DispatchConfig {
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultDispatchQueueSize
+	}
+	if config.Retries == nil || *config.Retries < 0 {
+		retries := defaultDispatchRetries
+		config.Retries = &retries
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultDispatchBackoff
+	}
+	return config
+}
+
+// DispatchStats are counters of a QueuedListener
+type DispatchStats struct {
+	Depth        int
+	Delivered    int
+	Retried      int
+	DeadLettered int
+}
+
+// QueuedListener wraps a Listener, delivering events to it asynchronously
+// from a bounded queue, with retries.
+// Events are delivered one at a time, in order, unless the listener asks for more workers.
+type QueuedListener struct {
+	Listener Listener
+	// identifies the listener in metrics
+	Name string
+	// counts the deliveries, if set, adding to the counts of the previous queues of the same Name
+	Metrics     *Metrics
+	config      DispatchConfig
+	deadLetters *deadLetterFile
+	deliveries  chan delivery
+	done        chan struct{}
+	// the context of deliveries, cancelled when a shutdown times out
+	ctx    context.Context
+	cancel context.CancelFunc
+	mutex  sync.Mutex
+	closed bool
+	stats  DispatchStats
+}
+
+// implemented by listeners that handle several deliveries at the same time
+type concurrentListener interface {
+	concurrency() int
+}
+
+// a single event, or a batch of events to deliver as a digest
+type delivery struct {
+	events []Event
+	digest bool
+}
+
+func NewQueuedListener(listener Listener, config DispatchConfig) *QueuedListener {
+	config = config.withDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := &QueuedListener{
+		Listener:    listener,
+		config:      config,
+		deadLetters: newDeadLetterFile(config.DeadLetterFile),
+		deliveries:  make(chan delivery, config.QueueSize),
+		done:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	workers := 1
+	if concurrent, ok := listener.(concurrentListener); ok && concurrent.concurrency() > 1 {
+		workers = concurrent.concurrency()
+	}
+	var working sync.WaitGroup
+	working.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer working.Done()
+			queue.work()
+		}()
+	}
+	go func() {
+		working.Wait()
+		close(queue.done)
+	}()
+	return queue
+}
+
+func (queue *QueuedListener) OnCrossPost(ctx context.Context, post Post, posts []Post) error {
+	return queue.OnEvent(ctx, newEvent(CrossPostEvent, post, posts))
+}
+
+func (queue *QueuedListener) OnDuplicate(ctx context.Context, post Post, posts []Post) error {
+	return queue.OnEvent(ctx, newEvent(DuplicateEvent, post, posts))
+}
+
+// OnEvent queues the event, to be delivered in the context of the queue rather than ctx
+func (queue *QueuedListener) OnEvent(ctx context.Context, event Event) error {
+	return queue.enqueue(delivery{events: []Event{event}})
+}
+
+func (queue *QueuedListener) OnDigest(ctx context.Context, events []Event) error {
+	return queue.enqueue(delivery{events: events, digest: true})
+}
+
+func (queue *QueuedListener) enqueue(d delivery) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	var err error
+	if queue.closed {
+		err = errors.New("queue closed")
+	} else {
+		select {
+		case queue.deliveries <- d:
+			return nil
+		default:
+			err = fmt.Errorf("queue full (%d)", queue.config.QueueSize)
+		}
+	}
+
+	queue.stats.DeadLettered += len(d.events)
+	queue.Metrics.Add("xpd_listener_failures_total", float64(len(d.events)), queue.name())
+	queue.deadLetters.write(queue.Listener, d.events, err)
+	return err
+}
+
+func (queue *QueuedListener) work() {
+	for d := range queue.deliveries {
+		if err := queue.deliver(queue.ctx, d); err != nil {
+			log.Printf("giving up delivery to %v: %s", queue.Listener, err)
+			queue.mutex.Lock()
+			queue.stats.DeadLettered += len(d.events)
+			queue.Metrics.Add("xpd_listener_failures_total", float64(len(d.events)), queue.name())
+			queue.mutex.Unlock()
+			queue.deadLetters.write(queue.Listener, d.events, err)
+		}
+	}
+}
+
+func (queue *QueuedListener) deliver(ctx context.Context, d delivery) error {
+	backoff := queue.config.Backoff
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := d.notify(ctx, queue.Listener)
+		if err == nil {
+			queue.mutex.Lock()
+			queue.stats.Delivered += len(d.events)
+			queue.Metrics.Add("xpd_listener_deliveries_total", float64(len(d.events)), queue.name())
+			queue.mutex.Unlock()
+			return nil
+		}
+		if attempt >= *queue.config.Retries {
+			return err
+		}
+		log.Printf("delivery to %v failed: %s; retrying in %s", queue.Listener, err, backoff)
+		queue.mutex.Lock()
+		queue.stats.Retried++
+		queue.Metrics.Add("xpd_listener_retries_total", 1, queue.name())
+		queue.mutex.Unlock()
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (d delivery) notify(ctx context.Context, listener Listener) error {
+	if receiver, ok := listener.(DigestReceiver); ok && d.digest {
+		return receiver.OnDigest(ctx, d.events)
+	}
+	for _, event := range d.events {
+		if err := event.notify(ctx, listener); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the counters of the queue
+func (queue *QueuedListener) Stats() DispatchStats {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	stats := queue.stats
+	stats.Depth = len(queue.deliveries)
+	return stats
+}
+
+// Close stops accepting events, and waits until the queued events are delivered
+func (queue *QueuedListener) Close() {
+	queue.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting events, and waits until the queued events are delivered.
+// If ctx is done first, the delivery in progress is cancelled,
+// and the remaining events are dead-lettered.
+func (queue *QueuedListener) Shutdown(ctx context.Context) error {
+	queue.mutex.Lock()
+	if !queue.closed {
+		queue.closed = true
+		close(queue.deliveries)
+	}
+	queue.mutex.Unlock()
+
+	defer queue.cancel()
+	select {
+	case <-queue.done:
+		return nil
+	case <-ctx.Done():
+		queue.cancel()
+		<-queue.done
+		return fmt.Errorf("%v: %s", queue, ctx.Err())
+	}
+}
+
+// name identifies the listener in metrics, by its Name if set
+func (queue *QueuedListener) name() string {
+	if queue.Name != "" {
+		return queue.Name
+	}
+	return fmt.Sprint(queue.Listener)
+}
+
+func (queue *QueuedListener) String() string {
+	return fmt.Sprintf("queued(%v, size=%d)", queue.Listener, queue.config.QueueSize)
+}
+
+// deadLetterFile appends undelivered events to a file, one JSON object per line
+type deadLetterFile struct {
+	path  string
+	mutex sync.Mutex
+}
+
+type deadLetter struct {
+	Time     time.Time `json:"time"`
+	Listener string    `json:"listener"`
+	Error    string    `json:"error"`
+	Events   []Event   `json:"events"`
+}
+
+// all queues share the same dead letter file, to serialize writes
+var deadLetterFiles = struct {
+	sync.Mutex
+	files map[string]*deadLetterFile
+}{files: make(map[string]*deadLetterFile)}
+
+func newDeadLetterFile(path string) *deadLetterFile {
+	deadLetterFiles.Lock()
+	defer deadLetterFiles.Unlock()
+	if file, ok := deadLetterFiles.files[path]; ok {
+		return file
+	}
+	file := &deadLetterFile{path: path}
+	deadLetterFiles.files[path] = file
+	return file
+}
+
+func (file *deadLetterFile) write(listener Listener, events []Event, err error) {
+	log.Printf("dead letter: %d event(s) not delivered to %v: %s", len(events), listener, err)
+	if file.path == "" {
+		return
+	}
+
+	line, jsonErr := json.Marshal(deadLetter{
+		Time:     time.Now(),
+		Listener: fmt.Sprint(listener),
+		Error:    err.Error(),
+		Events:   events,
+	})
+	if jsonErr != nil {
+		log.Printf("error: could not encode dead letter: %s", jsonErr)
+		return
+	}
+
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	f, openErr := os.OpenFile(file.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if openErr != nil {
+		log.Printf("error: could not open dead letter file: %s", openErr)
+		return
+	}
+	defer f.Close()
+
+	if _, writeErr := f.Write(append(line, '\n')); writeErr != nil {
+		log.Printf("error: could not write dead letter file: %s", writeErr)
+	}
+}
@@ -0,0 +1,217 @@
+package xpd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fails the first given number of deliveries
+type flakyListener struct {
+	mutex     sync.Mutex
+	failures  int
+	delivered int
+	digests   int
+}
+
+func (listener *flakyListener) notify() error {
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+	if listener.failures > 0 {
+		listener.failures--
+		return errors.New("flaky failure")
+	}
+	listener.delivered++
+	return nil
+}
+
+func (listener *flakyListener) OnCrossPost(context.Context, Post, []Post) error {
+	return listener.notify()
+}
+
+func (listener *flakyListener) OnDuplicate(context.Context, Post, []Post) error {
+	return listener.notify()
+}
+
+func (listener *flakyListener) OnDigest(context.Context, []Event) error {
+	listener.mutex.Lock()
+	listener.digests++
+	listener.mutex.Unlock()
+	return listener.notify()
+}
+
+// blocks deliveries until released, or cancelled
+type blockingListener struct {
+	release chan struct{}
+}
+
+func (listener *blockingListener) OnCrossPost(ctx context.Context, post Post, posts []Post) error {
+	select {
+	case <-listener.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (listener *blockingListener) OnDuplicate(ctx context.Context, post Post, posts []Post) error {
+	return listener.OnCrossPost(ctx, post, posts)
+}
+
+func Test_DispatchConfig_withDefaults(t *testing.T) {
+	config := DispatchConfig{}.withDefaults()
+	if config.QueueSize != defaultDispatchQueueSize || *config.Retries != defaultDispatchRetries || config.Backoff != defaultDispatchBackoff {
+		t.Fatalf("got %#v; expected defaults", config)
+	}
+
+	retries, none := 2, 0
+	custom := DispatchConfig{QueueSize: 1, Retries: &retries, Backoff: time.Second}
+	if actual := custom.withDefaults(); actual != custom {
+		t.Fatalf("got %#v; expected %#v unchanged", actual, custom)
+	}
+
+	never := DispatchConfig{Retries: &none}
+	if actual := never.withDefaults(); *actual.Retries != 0 {
+		t.Fatalf("got %d retries; expected none, as configured", *actual.Retries)
+	}
+}
+
+func Test_QueuedListener_retries_failed_delivery(t *testing.T) {
+	listener := &flakyListener{failures: 2}
+	retries := 2
+	queue := NewQueuedListener(listener, DispatchConfig{Retries: &retries, Backoff: time.Millisecond})
+
+	post := Post{Id: "1", Feed: &Feed{Id: "dummy"}}
+	if err := queue.OnCrossPost(context.Background(), post, []Post{post}); err != nil {
+		t.Fatalf("got error: %s; expected event enqueued", err)
+	}
+	queue.Close()
+
+	if listener.delivered != 1 {
+		t.Fatalf("got %d deliveries; expected 1 after retries", listener.delivered)
+	}
+	if stats := queue.Stats(); stats.Delivered != 1 || stats.Retried != 2 || stats.DeadLettered != 0 {
+		t.Fatalf("got %#v; expected 1 delivered after 2 retries", stats)
+	}
+}
+
+func Test_QueuedListener_writes_dead_letter_when_giving_up(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dead-letters.jsonl")
+
+	listener := &flakyListener{failures: 10}
+	retries := 1
+	queue := NewQueuedListener(listener, DispatchConfig{Retries: &retries, Backoff: time.Millisecond, DeadLetterFile: path})
+
+	post := Post{Id: "1", Feed: &Feed{Id: "dummy"}}
+	queue.OnDuplicate(context.Background(), post, []Post{post})
+	queue.Close()
+
+	if stats := queue.Stats(); stats.DeadLettered != 1 {
+		t.Fatalf("got %#v; expected 1 dead lettered event", stats)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d dead letters; expected 1", len(lines))
+	}
+
+	var letter deadLetter
+	if err := json.Unmarshal([]byte(lines[0]), &letter); err != nil {
+		t.Fatal(err)
+	}
+	if letter.Error != "flaky failure" || len(letter.Events) != 1 || letter.Events[0].Kind != DuplicateEvent {
+		t.Fatalf("got %#v; expected the failed duplicate event", letter)
+	}
+}
+
+func Test_QueuedListener_rejects_when_full(t *testing.T) {
+	listener := &blockingListener{release: make(chan struct{})}
+	queue := NewQueuedListener(listener, DispatchConfig{QueueSize: 1})
+
+	post := Post{Id: "1", Feed: &Feed{Id: "dummy"}}
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = queue.OnCrossPost(context.Background(), post, []Post{post})
+	}
+	if err == nil {
+		t.Fatal("got success; expected enqueue to fail when the queue is full")
+	}
+
+	close(listener.release)
+	queue.Close()
+
+	if stats := queue.Stats(); stats.DeadLettered != 1 || stats.Depth != 0 {
+		t.Fatalf("got %#v; expected 1 rejected event and empty queue", stats)
+	}
+}
+
+func Test_QueuedListener_rejects_when_closed(t *testing.T) {
+	queue := NewQueuedListener(&flakyListener{}, DispatchConfig{})
+	queue.Close()
+
+	post := Post{Id: "1", Feed: &Feed{Id: "dummy"}}
+	if err := queue.OnCrossPost(context.Background(), post, []Post{post}); err == nil {
+		t.Fatal("got success; expected enqueue to fail after close")
+	}
+}
+
+func Test_QueuedListener_delivers_digest_to_receiver(t *testing.T) {
+	listener := &flakyListener{}
+	queue := NewQueuedListener(listener, DispatchConfig{})
+
+	post := Post{Id: "1", Feed: &Feed{Id: "dummy"}}
+	queue.OnDigest(context.Background(), []Event{newEvent(CrossPostEvent, post, nil), newEvent(DuplicateEvent, post, nil)})
+	queue.Close()
+
+	if listener.digests != 1 || listener.delivered != 1 {
+		t.Fatalf("got %d digests, %d deliveries; expected a single digest delivery", listener.digests, listener.delivered)
+	}
+}
+
+func Test_QueuedListener_delivers_digest_per_event_to_plain_listener(t *testing.T) {
+	listener := &mockListener{}
+	queue := NewQueuedListener(listener, DispatchConfig{})
+
+	post := Post{Id: "1", Feed: &Feed{Id: "dummy"}}
+	queue.OnDigest(context.Background(), []Event{newEvent(CrossPostEvent, post, nil), newEvent(DuplicateEvent, post, nil)})
+	queue.Close()
+
+	if !listener.invokedWithCross || !listener.invokedWithDups {
+		t.Fatalf("got %#v; expected both events delivered", listener)
+	}
+}
+
+func Test_QueuedListener_Shutdown_dead_letters_after_timeout(t *testing.T) {
+	listener := &blockingListener{release: make(chan struct{})}
+	queue := NewQueuedListener(listener, DispatchConfig{})
+
+	post := Post{Id: "1", Feed: &Feed{Id: "dummy"}}
+	queue.OnCrossPost(context.Background(), post, []Post{post})
+	queue.OnCrossPost(context.Background(), post, []Post{post})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := queue.Shutdown(ctx); err == nil {
+		t.Fatal("got success; expected shutdown to time out")
+	}
+
+	if stats := queue.Stats(); stats.Delivered != 0 || stats.DeadLettered != 2 {
+		t.Fatalf("got %#v; expected both events dead lettered", stats)
+	}
+}
@@ -0,0 +1,280 @@
+package xpd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// datasetPost is a line of an evaluation dataset: a post like in the repository file,
+// labeled with the cluster of posts it is a copy of
+type datasetPost struct {
+	savedPost
+	// posts with the same cluster are duplicates or cross-posts of each other; empty for unique posts
+	Cluster string `json:"cluster"`
+}
+
+// evalSweep evaluates the detectors supporting param with each of the values
+type evalSweep struct {
+	param  string
+	values []string
+}
+
+// evalResult is the confusion matrix of detectors over the pairs of posts of a dataset
+type evalResult struct {
+	name           string
+	truePositives  int
+	falsePositives int
+	falseNegatives int
+	trueNegatives  int
+}
+
+func (result evalResult) precision() float64 {
+	return ratio(result.truePositives, result.truePositives+result.falsePositives)
+}
+
+func (result evalResult) recall() float64 {
+	return ratio(result.truePositives, result.truePositives+result.falseNegatives)
+}
+
+func (result evalResult) f1() float64 {
+	precision, recall := result.precision(), result.recall()
+	if precision+recall == 0 {
+		return 0
+	}
+	return 2 * precision * recall / (precision + recall)
+}
+
+// ratio is a/b, or NaN if b is 0
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return math.NaN()
+	}
+	return float64(a) / float64(b)
+}
+
+// Eval replays the labeled dataset of posts through the configured detectors,
+// and writes their precision, recall and F1 on the pairs of posts to w:
+// of each detector alone, of all the detectors together like when running,
+// and of each detector supporting the param of sweep, like "maxDiffRatio=0.05,0.1,0.2", with each value
+func Eval(configPath, datasetPath, sweep string, w io.Writer) error {
+	config, err := ParseConfig(configPath)
+	if err != nil {
+		return err
+	}
+	var sweeps []evalSweep
+	if sweep != "" {
+		parsed, err := parseEvalSweep(sweep)
+		if err != nil {
+			return err
+		}
+		sweeps = append(sweeps, parsed)
+	}
+	posts, clusters, err := loadDataset(datasetPath)
+	if err != nil {
+		return err
+	}
+	boilerplate, err := newBoilerplate(config.Boilerplate, config.Feeds)
+	if err != nil {
+		return err
+	}
+	posts = boilerplate.stripPosts(posts)
+
+	results, err := evaluateConfig(config.Detectors, sweeps, posts, clusters)
+	if err != nil {
+		return err
+	}
+	writeEvalReport(w, results, posts, clusters)
+	return nil
+}
+
+func parseEvalSweep(s string) (evalSweep, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return evalSweep{}, fmt.Errorf("invalid sweep, expected like maxDiffRatio=0.05,0.1,0.2: %s", s)
+	}
+	return evalSweep{param: parts[0], values: strings.Split(parts[1], ",")}, nil
+}
+
+// loadDataset reads a JSONL file of labeled posts,
+// returning the posts in order of publication, and their clusters
+func loadDataset(path string) ([]Post, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var lines []datasetPost
+	ids := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 10*1024*1024)
+	for number := 1; scanner.Scan(); number++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var line datasetPost
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %s", path, number, err)
+		}
+		if line.Id == "" {
+			return nil, nil, fmt.Errorf("%s:%d: missing id", path, number)
+		}
+		if ids[line.Id] {
+			return nil, nil, fmt.Errorf("%s:%d: duplicate id: %s", path, number, line.Id)
+		}
+		ids[line.Id] = true
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+
+	feeds := make(map[string]*Feed)
+	posts := make([]Post, len(lines))
+	clusters := make([]string, len(lines))
+	for i, line := range lines {
+		feed, ok := feeds[line.Feed]
+		if !ok {
+			feed = &Feed{Id: line.Feed}
+			feeds[line.Feed] = feed
+		}
+		posts[i] = line.toPost(feed)
+		clusters[i] = line.Cluster
+	}
+	return posts, clusters, nil
+}
+
+func evaluateConfig(items []TypeConfig, sweeps []evalSweep, posts []Post, clusters []string) ([]evalResult, error) {
+	var results []evalResult
+	var detectors []Detector
+	for _, item := range items {
+		detector, err := parseDetector(item)
+		if err != nil {
+			return nil, err
+		}
+		detectors = append(detectors, detector)
+		results = append(results, evaluate(evalName(item), []Detector{detector}, posts, clusters))
+	}
+	if len(items) > 1 {
+		results = append(results, evaluate("all detectors", detectors, posts, clusters))
+	}
+
+	for _, sweep := range sweeps {
+		swept := false
+		for _, item := range items {
+			if !detectorParams[item.Type].supports(sweep.param) {
+				continue
+			}
+			swept = true
+			for _, value := range sweep.values {
+				params := map[string]string{sweep.param: value}
+				for name, value := range item.Params {
+					if name != sweep.param {
+						params[name] = value
+					}
+				}
+				variant := TypeConfig{Type: item.Type, Params: params}
+				detector, err := parseDetector(variant)
+				if err != nil {
+					return nil, err
+				}
+				results = append(results, evaluate(evalName(variant), []Detector{detector}, posts, clusters))
+			}
+		}
+		if !swept {
+			return nil, fmt.Errorf("no configured detector supports the param: %s", sweep.param)
+		}
+	}
+	return results, nil
+}
+
+// evalName is the type of the detector, followed by its params
+func evalName(item TypeConfig) string {
+	var params []string
+	for name, value := range item.Params {
+		params = append(params, name+"="+value)
+	}
+	sort.Strings(params)
+	return strings.Join(append([]string{item.Type}, params...), " ")
+}
+
+// evaluate finds the matches of each post with the older posts, stripped like when running:
+// the matches of the first detector finding any, not in the same thread.
+// The pairs of a post and an older post are positive if they are in the same cluster.
+func evaluate(name string, detectors []Detector, posts []Post, clusters []string) evalResult {
+	result := evalResult{name: name}
+	index := make(map[string]int, len(posts))
+	for i, post := range posts {
+		index[post.Id] = i
+	}
+
+	ctx := context.Background()
+	for i, post := range posts {
+		predicted := make(map[int]bool)
+		older := excludeThread(post, posts[:i:i])
+		for _, detector := range detectors {
+			matches := detector.FindDuplicates(ctx, post, older)
+			for _, match := range matches {
+				predicted[index[match.Id]] = true
+			}
+			if len(matches) > 0 {
+				break
+			}
+		}
+
+		for j := 0; j < i; j++ {
+			labeled := clusters[i] != "" && clusters[i] == clusters[j]
+			switch {
+			case labeled && predicted[j]:
+				result.truePositives++
+			case predicted[j]:
+				result.falsePositives++
+			case labeled:
+				result.falseNegatives++
+			default:
+				result.trueNegatives++
+			}
+		}
+	}
+	return result
+}
+
+func writeEvalReport(w io.Writer, results []evalResult, posts []Post, clusters []string) {
+	positives := 0
+	for i := range posts {
+		for j := 0; j < i; j++ {
+			if clusters[i] != "" && clusters[i] == clusters[j] {
+				positives++
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d post(s), %d labeled pair(s) of copies\n\n", len(posts), positives)
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "DETECTOR\tTP\tFP\tFN\tTN\tPRECISION\tRECALL\tF1")
+	for _, result := range results {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", result.name,
+			result.truePositives, result.falsePositives, result.falseNegatives, result.trueNegatives,
+			formatRatio(result.precision()), formatRatio(result.recall()), formatRatio(result.f1()))
+	}
+	table.Flush()
+}
+
+func formatRatio(value float64) string {
+	if math.IsNaN(value) {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", value)
+}
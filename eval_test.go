@@ -0,0 +1,147 @@
+package xpd
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const evalTestDataset = `{"feed": "so", "id": "1", "time": "2016-03-01T10:00:00Z", "body": "the quick brown fox jumps over the lazy dog", "cluster": "fox"}
+{"feed": "gg", "id": "2", "time": "2016-03-01T11:00:00Z", "body": "the quick brown fox jumps over the lazy dog", "cluster": "fox"}
+
+{"feed": "so", "id": "4", "time": "2016-03-01T13:00:00Z", "body": "something else entirely"}
+{"feed": "gg", "id": "3", "time": "2016-03-01T12:00:00Z", "body": "the quick brown fox jumped over the lazy dog", "cluster": "fox"}
+`
+
+func writeEvalTestFiles(t *testing.T) (dir, config, dataset string) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = filepath.Join(dir, "xpd.yml")
+	dataset = filepath.Join(dir, "dataset.jsonl")
+	content := `feeds:
+  - id: so
+    url: http://localhost/so
+detectors:
+  - type: SameBodyDetector
+  - type: SimilarWordCountDetector
+`
+	if err := ioutil.WriteFile(config, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dataset, []byte(evalTestDataset), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir, config, dataset
+}
+
+func Test_loadDataset_sorts_by_time(t *testing.T) {
+	dir, _, dataset := writeEvalTestFiles(t)
+	defer os.RemoveAll(dir)
+
+	posts, clusters, err := loadDataset(dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 4 || posts[2].Id != "3" || posts[3].Id != "4" || clusters[2] != "fox" || clusters[3] != "" {
+		t.Fatalf("got %#v, %#v; expected the posts in order of publication", posts, clusters)
+	}
+	if posts[0].Feed != posts[3].Feed || posts[0].Feed.Id != "so" {
+		t.Fatalf("got %#v; expected the posts of a feed to share it", posts[0].Feed)
+	}
+}
+
+func Test_loadDataset_rejects_duplicate_ids(t *testing.T) {
+	dir, _, dataset := writeEvalTestFiles(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(dataset, []byte(`{"id": "1"}`+"\n"+`{"id": "1"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := loadDataset(dataset); err == nil || !strings.Contains(err.Error(), ":2: duplicate id") {
+		t.Fatalf("got %v; expected the duplicate id reported with its line", err)
+	}
+}
+
+func Test_evaluate_confusion_matrix(t *testing.T) {
+	dir, _, dataset := writeEvalTestFiles(t)
+	defer os.RemoveAll(dir)
+	posts, clusters, err := loadDataset(dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := evaluate("same", []Detector{SameBodyDetector{}}, posts, clusters)
+	expected := evalResult{name: "same", truePositives: 1, falseNegatives: 2, trueNegatives: 3}
+	if result != expected {
+		t.Fatalf("got %#v; expected %#v", result, expected)
+	}
+	if result.precision() != 1 || math.Abs(result.recall()-1.0/3) > 1e-9 || math.Abs(result.f1()-0.5) > 1e-9 {
+		t.Fatalf("got precision %v, recall %v, f1 %v; expected 1, 1/3, 0.5", result.precision(), result.recall(), result.f1())
+	}
+
+	loose := evaluate("loose", []Detector{NewSimilarWordCountDetector(0.3)}, posts, clusters)
+	if loose.truePositives != 3 || loose.falsePositives != 0 {
+		t.Fatalf("got %#v; expected all the copies found", loose)
+	}
+}
+
+func Test_Eval_report_with_sweep(t *testing.T) {
+	dir, config, dataset := writeEvalTestFiles(t)
+	defer os.RemoveAll(dir)
+
+	var report strings.Builder
+	if err := Eval(config, dataset, "maxDiffRatio=0.1,0.3", &report); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"4 post(s), 3 labeled pair(s) of copies",
+		"SameBodyDetector ",
+		"all detectors ",
+		"SimilarWordCountDetector maxDiffRatio=0.1 ",
+		"SimilarWordCountDetector maxDiffRatio=0.3 ",
+	} {
+		if !strings.Contains(report.String(), expected) {
+			t.Errorf("got report without %#v:\n%s", expected, report.String())
+		}
+	}
+
+	if err := Eval(config, dataset, "nonexistent=1", &report); err == nil {
+		t.Fatal("got success; expected sweep of unsupported param to fail")
+	}
+}
+
+func Test_Eval_strips_posts_like_when_running(t *testing.T) {
+	dir, config, dataset := writeEvalTestFiles(t)
+	defer os.RemoveAll(dir)
+	content := `feeds:
+  - id: so
+    url: http://localhost/so
+    ignorePatterns: ["^sent from my phone$"]
+detectors:
+  - type: SameBodyDetector
+`
+	lines := `{"feed": "gg", "id": "1", "time": "2016-03-01T10:00:00Z", "body": "<p>the quick brown fox</p>", "cluster": "fox"}
+{"feed": "so", "id": "2", "time": "2016-03-01T11:00:00Z", "body": "<p>the quick brown fox</p><p>sent from my phone</p>", "cluster": "fox"}
+`
+	if err := ioutil.WriteFile(config, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dataset, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var report strings.Builder
+	if err := Eval(config, dataset, "", &report); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`SameBodyDetector +1 +0 +0 +0 `).MatchString(report.String()) {
+		t.Fatalf("got report:\n%s\nexpected the copy found without the ignored line", report.String())
+	}
+}
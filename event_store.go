@@ -0,0 +1,71 @@
+package xpd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// number of recent events to keep in memory
+const defaultEventStoreCapacity = 1000
+
+// StoredEvent is an Event with a sequential id assigned by the EventStore
+type StoredEvent struct {
+	Id int
+	Event
+}
+
+// EventStore is a listener that keeps the recent events in memory
+type EventStore struct {
+	mutex    sync.RWMutex
+	events   []StoredEvent
+	capacity int
+	lastId   int
+}
+
+func NewEventStore() *EventStore {
+	return &EventStore{capacity: defaultEventStoreCapacity}
+}
+
+func (store *EventStore) OnCrossPost(ctx context.Context, post Post, posts []Post) error {
+	return store.OnEvent(ctx, newEvent(CrossPostEvent, post, posts))
+}
+
+func (store *EventStore) OnDuplicate(ctx context.Context, post Post, posts []Post) error {
+	return store.OnEvent(ctx, newEvent(DuplicateEvent, post, posts))
+}
+
+func (store *EventStore) OnEvent(ctx context.Context, event Event) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.lastId++
+	events := store.events
+	if len(events) >= store.capacity {
+		events = events[1:]
+	}
+	store.events = append(events, StoredEvent{Id: store.lastId, Event: event})
+	return nil
+}
+
+// FindRecent returns the stored events, oldest first
+func (store *EventStore) FindRecent() []StoredEvent {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.events
+}
+
+func (store *EventStore) Find(id int) (StoredEvent, bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	for _, event := range store.events {
+		if event.Id == id {
+			return event, true
+		}
+	}
+	return StoredEvent{}, false
+}
+
+func (store *EventStore) String() string {
+	return fmt.Sprintf("EventStore(capacity=%d)", store.capacity)
+}
@@ -0,0 +1,28 @@
+package xpd
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_EventStore_keeps_recent_events_with_ids(t *testing.T) {
+	store := NewEventStore()
+	store.capacity = 2
+
+	post := Post{Id: "1", Feed: &Feed{Id: "dummy"}}
+	store.OnDuplicate(context.Background(), post, nil)
+	store.OnCrossPost(context.Background(), post, nil)
+	store.OnDuplicate(context.Background(), post, nil)
+
+	events := store.FindRecent()
+	if len(events) != 2 || events[0].Id != 2 || events[1].Id != 3 {
+		t.Fatalf("got %#v; expected the last 2 events", events)
+	}
+
+	if event, ok := store.Find(2); !ok || event.Kind != CrossPostEvent {
+		t.Fatalf("got %#v, %t; expected to find the cross-post", event, ok)
+	}
+	if _, ok := store.Find(1); ok {
+		t.Fatal("got evicted event; expected not found")
+	}
+}
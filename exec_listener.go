@@ -0,0 +1,160 @@
+package xpd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xpd-org/xpd/secret"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultExecTimeout = time.Minute
+
+const defaultExecConcurrency = 1
+
+// ExecListener runs a shell command per event, with the EventRecord as JSON on stdin,
+// and its main fields in environment variables prefixed with XPD_.
+// Its queue delivers events to it with as many workers as its concurrency,
+// so that up to that many commands run at the same time.
+type ExecListener struct {
+	// interpolated, it may contain secrets
+	Command secret.Value
+	// the command before interpolation, shown in logs
+	configured string
+	timeout    time.Duration
+	workers    int
+	running    sync.WaitGroup
+}
+
+func NewExecListener(params map[string]string) (*ExecListener, error) {
+	listener := &ExecListener{
+		Command:    secret.Value(params["command"]),
+		configured: params["command"],
+		timeout:    defaultExecTimeout,
+		workers:    defaultExecConcurrency,
+	}
+	if listener.Command == "" {
+		return nil, errors.New("exec: missing command")
+	}
+
+	if s, ok := params["timeout"]; ok {
+		timeout, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("exec: invalid timeout: %s", err)
+		}
+		listener.timeout = timeout
+	}
+
+	if s, ok := params["concurrency"]; ok {
+		value, err := strconv.Atoi(s)
+		if err != nil || value < 1 {
+			return nil, fmt.Errorf("exec: invalid concurrency: %s", s)
+		}
+		listener.workers = value
+	}
+
+	return listener, nil
+}
+
+func (listener *ExecListener) OnCrossPost(ctx context.Context, post Post, posts []Post) error {
+	return listener.OnEvent(ctx, newEvent(CrossPostEvent, post, posts))
+}
+
+func (listener *ExecListener) OnDuplicate(ctx context.Context, post Post, posts []Post) error {
+	return listener.OnEvent(ctx, newEvent(DuplicateEvent, post, posts))
+}
+
+// OnEvent runs the command, killing it on timeout or when ctx is done,
+// and returns its failure with its stderr, to be retried or dead-lettered like the failures of other listeners
+func (listener *ExecListener) OnEvent(ctx context.Context, event Event) error {
+	stdin, err := json.Marshal(newEventRecord(event))
+	if err != nil {
+		return err
+	}
+
+	listener.running.Add(1)
+	defer listener.running.Done()
+	return listener.run(ctx, event, stdin)
+}
+
+func (listener *ExecListener) concurrency() int {
+	return listener.workers
+}
+
+func (listener *ExecListener) run(ctx context.Context, event Event, stdin []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, listener.timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", string(listener.Command))
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", string(listener.Command))
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), eventEnv(event)...)
+	// don't wait for children of the shell holding stderr open after a timeout
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", listener.timeout)
+		}
+		return fmt.Errorf("%s; stderr:\n%s", err, stderr.String())
+	}
+	return nil
+}
+
+// Wait waits for the running commands to finish
+func (listener *ExecListener) Wait() {
+	listener.running.Wait()
+}
+
+// Shutdown waits for the running commands to finish, or until ctx is done
+func (listener *ExecListener) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		listener.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("exec: commands still running: %s", ctx.Err())
+	}
+}
+
+func (listener *ExecListener) String() string {
+	return fmt.Sprintf("exec(%s, timeout=%s, concurrency=%d)", listener.configured, listener.timeout, listener.workers)
+}
+
+func eventEnv(event Event) []string {
+	urls := make([]string, len(event.Posts))
+	for i, post := range event.Posts {
+		urls[i] = post.Url
+	}
+	return []string{
+		"XPD_EVENT_KIND=" + string(event.Kind),
+		"XPD_DETECTOR=" + event.Detector,
+		"XPD_SCORE=" + strconv.FormatFloat(event.Score, 'f', -1, 64),
+		"XPD_FEED_ID=" + event.Post.Feed.Id,
+		"XPD_POST_ID=" + event.Post.Id,
+		"XPD_POST_URL=" + event.Post.Url,
+		"XPD_POST_AUTHOR=" + event.Post.Author,
+		"XPD_POST_SUBJECT=" + event.Post.Subject,
+		"XPD_MATCHED_URLS=" + strings.Join(urls, " "),
+		"XPD_EDITED=" + strconv.FormatBool(event.Edited),
+	}
+}
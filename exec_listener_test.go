@@ -0,0 +1,146 @@
+package xpd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_NewExecListener_validates_params(t *testing.T) {
+	invalid := []map[string]string{
+		{},
+		{"command": "true", "timeout": "soon"},
+		{"command": "true", "concurrency": "0"},
+		{"command": "true", "concurrency": "many"},
+	}
+	for _, params := range invalid {
+		if _, err := NewExecListener(params); err == nil {
+			t.Errorf("got success; expected invalid params to fail: %#v", params)
+		}
+	}
+}
+
+func Test_ExecListener_passes_event_on_stdin_and_env(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stdinPath := filepath.Join(dir, "stdin.json")
+	envPath := filepath.Join(dir, "env.txt")
+
+	listener, err := NewExecListener(map[string]string{
+		"command": "cat > " + stdinPath + "; echo $XPD_EVENT_KIND $XPD_POST_ID $XPD_MATCHED_URLS > " + envPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := Post{Id: "2", Feed: &Feed{Id: "so"}}
+	old := Post{Id: "1", Url: "http://old", Feed: &Feed{Id: "gg"}}
+	listener.OnCrossPost(context.Background(), post, []Post{old})
+	listener.Wait()
+
+	var event EventRecord
+	content, _ := ioutil.ReadFile(stdinPath)
+	if err := json.Unmarshal(content, &event); err != nil {
+		t.Fatalf("got %s; expected event as JSON on stdin", content)
+	}
+	if event.Kind != CrossPostEvent || event.Post.Id != "2" || event.Schema != EventSchemaVersion {
+		t.Fatalf("got %#v; expected the cross-post event", event)
+	}
+
+	env, _ := ioutil.ReadFile(envPath)
+	if actual, expected := strings.TrimSpace(string(env)), "cross-post 2 http://old"; actual != expected {
+		t.Fatalf("got env %#v; expected %#v", actual, expected)
+	}
+}
+
+func Test_ExecListener_failure_and_timeout_fail_delivery(t *testing.T) {
+	post := Post{Id: "1", Feed: &Feed{Id: "so"}}
+
+	for _, example := range []struct {
+		params   map[string]string
+		expected string
+	}{
+		{map[string]string{"command": "echo oops >&2; exit 1"}, "oops"},
+		{map[string]string{"command": "exec sleep 5", "timeout": "10ms"}, "timed out after 10ms"},
+	} {
+		listener, _ := NewExecListener(example.params)
+		err := listener.OnDuplicate(context.Background(), post, []Post{post})
+		if err == nil || !strings.Contains(err.Error(), example.expected) {
+			t.Errorf("got %v; expected the failure of the command returned, to be retried", err)
+		}
+	}
+}
+
+func Test_ExecListener_command_killed_when_delivery_cancelled(t *testing.T) {
+	listener, _ := NewExecListener(map[string]string{"command": "exec sleep 5"})
+	post := Post{Id: "1", Feed: &Feed{Id: "so"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := listener.OnDuplicate(ctx, post, nil); err == nil || time.Since(start) > time.Second {
+		t.Fatalf("got %v after %s; expected the command killed with the delivery", err, time.Since(start))
+	}
+}
+
+func Test_ExecListener_queue_runs_concurrency_commands_at_once(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// each command waits for the other to start
+	listener, _ := NewExecListener(map[string]string{
+		"command":     "touch " + dir + "/$XPD_POST_ID; while [ $(ls " + dir + " | wc -l) -lt 2 ]; do sleep 0.01; done",
+		"timeout":     "2s",
+		"concurrency": "2",
+	})
+	queue := NewQueuedListener(listener, DispatchConfig{Retries: new(int)})
+	for _, id := range []string{"1", "2"} {
+		post := Post{Id: id, Feed: &Feed{Id: "so"}}
+		queue.OnDuplicate(context.Background(), post, nil)
+	}
+	queue.Close()
+
+	if stats := queue.Stats(); stats.Delivered != 2 {
+		t.Fatalf("got %#v; expected both commands running at the same time", stats)
+	}
+}
+
+func Test_ExecListener_run_reports_stderr(t *testing.T) {
+	listener, _ := NewExecListener(map[string]string{"command": "echo oops >&2; exit 1"})
+	post := Post{Id: "1", Feed: &Feed{Id: "so"}}
+
+	err := listener.run(context.Background(), newEvent(DuplicateEvent, post, nil), nil)
+	if err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Fatalf("got %v; expected error with stderr of command", err)
+	}
+}
+
+func Test_parseListener_exec_does_not_log_secrets(t *testing.T) {
+	os.Setenv("XPD_TEST_EXEC_TOKEN", "hunter2")
+	defer os.Unsetenv("XPD_TEST_EXEC_TOKEN")
+
+	listener, err := parseListener(TypeConfig{Type: "exec", Params: map[string]string{"command": "notify --token ${XPD_TEST_EXEC_TOKEN}"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"%v", "%+v", "%#v"} {
+		if actual := fmt.Sprintf(format, listener); strings.Contains(actual, "hunter2") {
+			t.Errorf("got %s with %s; expected the interpolated command redacted", actual, format)
+		}
+	}
+	if actual, expected := fmt.Sprint(listener), "exec(notify --token ${XPD_TEST_EXEC_TOKEN}, "; !strings.HasPrefix(actual, expected) {
+		t.Errorf("got %s; expected the command as configured", actual)
+	}
+}
@@ -0,0 +1,270 @@
+package xpd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// posts are compared as sequences of this many words, to show the text they share
+const explainShingleSize = 5
+
+// at most this many shared shingles and common lines are shown
+const explainMaxShown = 10
+
+var htmlCodeBlocks = regexp.MustCompile(`(?is)<(pre|code)[^>]*>(.*?)</(pre|code)>`)
+
+// the elements of fetched pages that may contain the post, most specific first:
+// the body of the question of Stack Exchange, of the first post of Discourse, else the article or main content of the page
+var htmlPostElements = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)<(div)\b[^>]*\bclass="[^"]*\b(?:js-post-body|cooked)\b[^"]*"[^>]*>`),
+	regexp.MustCompile(`(?i)<(article)\b[^>]*>`),
+	regexp.MustCompile(`(?i)<(main)\b[^>]*>`),
+	regexp.MustCompile(`(?i)<(body)\b[^>]*>`),
+}
+
+var htmlScripts = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>`)
+
+// Explain compares the first post with the second, like a new post with an older one,
+// and writes the verdict, score and explanation of each configured detector to w,
+// followed by the shingles of words and the lines of code the posts share.
+// Posts are given as ids of posts in the repository file, paths of files, or URLs to fetch.
+func Explain(configPath, first, second string, w io.Writer) error {
+	config, err := ParseConfig(configPath)
+	if err != nil {
+		return err
+	}
+	repo := NewPostRepository()
+	if config.Repository.File != "" {
+		if err := loadPosts(repo, config.Repository.File, config.Feeds); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	post, err := resolveExplainPost(ctx, repo, first)
+	if err != nil {
+		return err
+	}
+	other, err := resolveExplainPost(ctx, repo, second)
+	if err != nil {
+		return err
+	}
+
+	boilerplate, err := newBoilerplate(config.Boilerplate, config.Feeds)
+	if err != nil {
+		return err
+	}
+	stripped := stripExplainPosts(boilerplate, repo, post, other)
+
+	var detectors []Detector
+	for _, item := range config.Detectors {
+		detector, err := parseDetector(item)
+		if err != nil {
+			return err
+		}
+		detectors = append(detectors, detector)
+	}
+	writeExplanation(ctx, w, detectors, stripped[0], stripped[1])
+	return nil
+}
+
+// stripExplainPosts returns the posts as compared by the detectors when running,
+// without the boilerplate learned from the posts of the repository, nor their quotes
+func stripExplainPosts(boilerplate *boilerplate, repo PostRepository, posts ...Post) []Post {
+	recent := repo.FindRecent()
+	learned := make(map[string]Post)
+	for i, post := range boilerplate.stripPosts(recent) {
+		learned[postKey(recent[i])] = post
+	}
+
+	stripped := make([]Post, len(posts))
+	for i, post := range posts {
+		if post, ok := learned[postKey(post)]; ok {
+			stripped[i] = post
+			continue
+		}
+		stripped[i] = stripQuotes(post)
+	}
+	return stripped
+}
+
+// resolveExplainPost finds the post in the repository by id or URL, else reads the file at the path,
+// else fetches the URL, keeping the content of the post of the page
+func resolveExplainPost(ctx context.Context, repo PostRepository, arg string) (Post, error) {
+	for _, post := range repo.FindRecent() {
+		if post.Id == arg || post.Url == arg {
+			return post, nil
+		}
+	}
+
+	if content, err := ioutil.ReadFile(arg); err == nil {
+		return Post{Id: arg, Url: arg, Body: string(content)}, nil
+	} else if !os.IsNotExist(err) {
+		return Post{}, err
+	}
+
+	if isHttpUrl(arg) {
+		content, err := fetchFeed(ctx, Feed{}, arg)
+		if err != nil {
+			return Post{}, fmt.Errorf("%s: %s", arg, err)
+		}
+		return Post{Id: arg, Url: arg, Body: extractPostContent(string(content))}, nil
+	}
+	return Post{}, fmt.Errorf("not a post of the repository, a file, nor a URL: %s", arg)
+}
+
+// extractPostContent returns the content of the element of the page containing the post, without scripts and styles,
+// or the page itself if it has none
+func extractPostContent(page string) string {
+	page = htmlScripts.ReplaceAllString(page, "")
+	for _, start := range htmlPostElements {
+		loc := start.FindStringSubmatchIndex(page)
+		if loc == nil {
+			continue
+		}
+		// the end tag matching the start tag, after the elements of the same name it contains
+		tags := regexp.MustCompile(`(?i)<(/?)` + page[loc[2]:loc[3]] + `\b[^>]*>`)
+		depth := 1
+		for _, tag := range tags.FindAllStringSubmatchIndex(page[loc[1]:], -1) {
+			if tag[3] > tag[2] {
+				depth--
+			} else {
+				depth++
+			}
+			if depth == 0 {
+				return strings.TrimSpace(page[loc[1] : loc[1]+tag[0]])
+			}
+		}
+		return strings.TrimSpace(page[loc[1]:])
+	}
+	return page
+}
+
+func writeExplanation(ctx context.Context, w io.Writer, detectors []Detector, post, other Post) {
+	fmt.Fprintf(w, "first: %s\nsecond: %s\n", summaryOfExplainPost(post), summaryOfExplainPost(other))
+
+	for _, detector := range detectors {
+		verdict := "different"
+		if len(detector.FindDuplicates(ctx, post, []Post{other})) > 0 {
+			verdict = "similar"
+		}
+		fmt.Fprintf(w, "\n%s: %s\n", detectorName(detector), verdict)
+		if scorer, ok := detector.(Scorer); ok {
+			fmt.Fprintf(w, "  score: %.3f\n", scorer.Score(post, other))
+		}
+		if explainer, ok := detector.(Explainer); ok {
+			explanation := explainer.Explain(post, other)
+			for _, detail := range explanation.Details {
+				fmt.Fprintf(w, "  %s\n", detail)
+			}
+			writeExplanationTable(w, explanation.Table)
+		}
+	}
+
+	shared, total := sharedShingles(post.Body, other.Body)
+	fmt.Fprintf(w, "\nshared sequences of %d words: %d of %d\n", explainShingleSize, len(shared), total)
+	writeExplanationList(w, shared)
+
+	common := commonCodeLines(post.Body, other.Body)
+	fmt.Fprintf(w, "\ncommon lines of code: %d\n", len(common))
+	writeExplanationList(w, common)
+}
+
+func summaryOfExplainPost(post Post) string {
+	if post.Feed == nil {
+		return post.Id
+	}
+	return fmt.Sprintf("%s of %s, by %s at %s: %s", post.Id, post.Feed.Id, post.Author, post.Time.Format("2006-01-02 15:04"), post.Subject)
+}
+
+// writeExplanationTable writes the rows indented, except the header if it is the only row
+func writeExplanationTable(w io.Writer, rows [][]string) {
+	if len(rows) < 2 {
+		return
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintf(table, "  %s\n", strings.Join(row, "\t"))
+	}
+	table.Flush()
+}
+
+func writeExplanationList(w io.Writer, items []string) {
+	for i, item := range items {
+		if i == explainMaxShown {
+			fmt.Fprintf(w, "  ... and %d more\n", len(items)-explainMaxShown)
+			break
+		}
+		fmt.Fprintf(w, "  %s\n", item)
+	}
+}
+
+// sharedShingles returns the sequences of words of the first text that are also in the second, in order,
+// and the number of distinct sequences of the first text
+func sharedShingles(first, second string) ([]string, int) {
+	others := make(map[string]bool)
+	for _, shingle := range shingles(second) {
+		others[shingle] = true
+	}
+
+	var shared []string
+	seen := make(map[string]bool)
+	for _, shingle := range shingles(first) {
+		if seen[shingle] {
+			continue
+		}
+		seen[shingle] = true
+		if others[shingle] {
+			shared = append(shared, shingle)
+		}
+	}
+	return shared, len(seen)
+}
+
+// shingles are the sequences of explainShingleSize consecutive words of the plain text
+func shingles(body string) []string {
+	var words []string
+	for _, word := range splitToWords(strings.Join(plainText(body), " ")) {
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	var shingles []string
+	for i := 0; i+explainShingleSize <= len(words); i++ {
+		shingles = append(shingles, strings.Join(words[i:i+explainShingleSize], " "))
+	}
+	return shingles
+}
+
+// commonCodeLines returns the lines of the code blocks of the first body that are also in the second, in order
+func commonCodeLines(first, second string) []string {
+	others := make(map[string]bool)
+	for _, line := range codeLines(second) {
+		others[line] = true
+	}
+
+	var common []string
+	seen := make(map[string]bool)
+	for _, line := range codeLines(first) {
+		if others[line] && !seen[line] {
+			seen[line] = true
+			common = append(common, line)
+		}
+	}
+	return common
+}
+
+// codeLines are the lines of the <pre> and <code> blocks of the body
+func codeLines(body string) []string {
+	var lines []string
+	for _, match := range htmlCodeBlocks.FindAllStringSubmatch(body, -1) {
+		lines = append(lines, plainText(match[2])...)
+	}
+	return lines
+}
@@ -0,0 +1,108 @@
+package xpd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Explain_shows_verdicts_and_evidence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "xpd.yml")
+	first := filepath.Join(dir, "first.html")
+	second := filepath.Join(dir, "second.html")
+	for path, content := range map[string]string{
+		config: `feeds:
+  - id: so
+    url: http://localhost/so
+detectors:
+  - type: SameBodyDetector
+  - type: SimilarWordCountDetector
+    params:
+      maxDiffRatio: 0.5
+`,
+		first:  "<p>the quick brown fox jumps over the lazy dog</p><pre>fox.jump()\ndog.sleep()</pre>",
+		second: "<p>the quick brown fox jumped over the lazy dog</p><pre>fox.jump()</pre>",
+	} {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := Explain(config, first, second, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"SameBodyDetector: different\n",
+		"SimilarWordCountDetector: similar\n",
+		"word count diffs: 4 < 8.50 (similar)",
+		"  jumped  0      1       1\n",
+		"shared sequences of 5 words: 2 of 9\n  over the lazy dog fox\n",
+		"common lines of code: 1\n  fox.jump()\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatalf("got:\n%s\nexpected to contain:\n%s", out.String(), expected)
+		}
+	}
+}
+
+func Test_resolveExplainPost(t *testing.T) {
+	repo := NewPostRepository()
+	repo.Add(Post{Id: "http://stackoverflow.com/q/1", Body: "saved", Feed: &Feed{Id: "so"}})
+	repo.Add(Post{Id: "2", Url: "http://stackoverflow.com/q/2", Body: "saved by url", Feed: &Feed{Id: "so"}})
+	ctx := context.Background()
+
+	if post, err := resolveExplainPost(ctx, repo, "http://stackoverflow.com/q/1"); err != nil || post.Body != "saved" {
+		t.Fatalf("got %#v, %v; expected the post of the repository", post, err)
+	}
+	if post, err := resolveExplainPost(ctx, repo, "http://stackoverflow.com/q/2"); err != nil || post.Body != "saved by url" {
+		t.Fatalf("got %#v, %v; expected the post of the repository with the URL", post, err)
+	}
+	if _, err := resolveExplainPost(ctx, repo, "nonexistent"); err == nil {
+		t.Fatal("got success; expected an error for an unknown post")
+	}
+}
+
+func Test_stripExplainPosts(t *testing.T) {
+	repo := NewPostRepository()
+	feed := &Feed{Id: "ml"}
+	for i := 0; i < defaultBoilerplateMinPosts; i++ {
+		repo.Add(Post{Id: fmt.Sprint(i), Body: fmt.Sprintf("<p>question %d</p><p>the footer of the list</p>", i), Feed: feed})
+	}
+	boilerplate, _ := newBoilerplate(BoilerplateConfig{}, nil)
+	reply := Post{Id: "file", Parent: "1", Body: "<blockquote>quoted</blockquote><p>answer</p>"}
+
+	stripped := stripExplainPosts(boilerplate, repo, repo.FindRecent()[4], reply)
+	if actual, expected := stripped[0].Body, "<p>question 4</p>"; actual != expected {
+		t.Fatalf("got %#v; expected the boilerplate learned from the repository stripped", actual)
+	}
+	if actual, expected := stripped[1].Body, "<p>answer</p>"; actual != expected {
+		t.Fatalf("got %#v; expected the quotes stripped", actual)
+	}
+}
+
+func Test_extractPostContent(t *testing.T) {
+	for _, example := range []struct{ page, expected string }{
+		{`<html><head><title>q</title><script>var x = "<div>";</script></head><body><nav>menu</nav>` +
+			`<div class="s-prose js-post-body" itemprop="text"><p>question</p><div class="snippet"><pre>code</pre></div></div>` +
+			`<div class="answer">answer</div></body></html>`, `<p>question</p><div class="snippet"><pre>code</pre></div>`},
+		{`<html><body><header>site</header><article><p>topic</p></article></body></html>`, `<p>topic</p>`},
+		{`<html><body><p>page</p></body></html>`, `<p>page</p>`},
+		{`<p>fragment</p>`, `<p>fragment</p>`},
+	} {
+		if actual := extractPostContent(example.page); actual != example.expected {
+			t.Errorf("got %q; expected %q", actual, example.expected)
+		}
+	}
+}
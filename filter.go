@@ -0,0 +1,156 @@
+package xpd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// FilterConfig selects the events a listener should be notified of.
+// All the configured criteria must match, empty criteria match anything.
+type FilterConfig struct {
+	// at least one of the feeds involved in the event must be in the list
+	Feeds []string
+	// the event must involve both feeds of one of the pairs
+	FeedPairs [][]string `yaml:"feedPairs"`
+	// "duplicate", "cross-post" or "no-longer-matches"
+	Kinds     []EventKind
+	MinScore  float64 `yaml:"minScore"`
+	Detectors []string
+	// regular expression to match against the author of the new post
+	Author string
+}
+
+type EventFilter struct {
+	config FilterConfig
+	author *regexp.Regexp
+}
+
+func NewEventFilter(config FilterConfig) (*EventFilter, error) {
+	filter := &EventFilter{config: config}
+
+	for _, pair := range config.FeedPairs {
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("filter: feed pair must have 2 feed ids: %v", pair)
+		}
+	}
+	for _, kind := range config.Kinds {
+		if kind != DuplicateEvent && kind != CrossPostEvent && kind != NoLongerMatchesEvent {
+			return nil, fmt.Errorf("filter: unsupported event kind: %s", kind)
+		}
+	}
+	if config.Author != "" {
+		author, err := regexp.Compile(config.Author)
+		if err != nil {
+			return nil, fmt.Errorf("filter: invalid author pattern: %s", err)
+		}
+		filter.author = author
+	}
+
+	return filter, nil
+}
+
+func (filter *EventFilter) Accepts(event Event) bool {
+	config := filter.config
+
+	feeds := event.feedIds()
+	if len(config.Feeds) > 0 && !containsAny(feeds, config.Feeds) {
+		return false
+	}
+	if len(config.FeedPairs) > 0 && !filter.matchesFeedPair(event) {
+		return false
+	}
+	if len(config.Kinds) > 0 && !containsKind(config.Kinds, event.Kind) {
+		return false
+	}
+	if event.Score < config.MinScore {
+		return false
+	}
+	if len(config.Detectors) > 0 && !containsAny(config.Detectors, []string{event.Detector}) {
+		return false
+	}
+	if filter.author != nil && !filter.author.MatchString(event.Post.Author) {
+		return false
+	}
+	return true
+}
+
+// the new post must be in one feed of a pair, and a matched post in the other
+func (filter *EventFilter) matchesFeedPair(event Event) bool {
+	for _, pair := range filter.config.FeedPairs {
+		for i, feedId := range pair {
+			if event.Post.Feed.Id != feedId {
+				continue
+			}
+			other := pair[1-i]
+			for _, post := range event.Posts {
+				if post.Feed.Id == other {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (filter *EventFilter) String() string {
+	return fmt.Sprintf("%+v", filter.config)
+}
+
+// FilteredListener wraps a Listener, notifying it only of the events accepted by the filter
+type FilteredListener struct {
+	Listener Listener
+	Filter   *EventFilter
+}
+
+func (listener *FilteredListener) OnCrossPost(ctx context.Context, post Post, posts []Post) error {
+	return listener.OnEvent(ctx, newEvent(CrossPostEvent, post, posts))
+}
+
+func (listener *FilteredListener) OnDuplicate(ctx context.Context, post Post, posts []Post) error {
+	return listener.OnEvent(ctx, newEvent(DuplicateEvent, post, posts))
+}
+
+func (listener *FilteredListener) OnEvent(ctx context.Context, event Event) error {
+	if !listener.Filter.Accepts(event) {
+		return nil
+	}
+	return event.notify(ctx, listener.Listener)
+}
+
+func (listener *FilteredListener) String() string {
+	return fmt.Sprintf("filtered(%v, %v)", listener.Listener, listener.Filter)
+}
+
+// feedIds are the distinct ids of the feeds involved in the event
+func (event Event) feedIds() []string {
+	seen := map[string]bool{event.Post.Feed.Id: true}
+	ids := []string{event.Post.Feed.Id}
+	for _, post := range event.Posts {
+		if !seen[post.Feed.Id] {
+			seen[post.Feed.Id] = true
+			ids = append(ids, post.Feed.Id)
+		}
+	}
+	return ids
+}
+
+func containsAny(items []string, wanted []string) bool {
+	for _, item := range items {
+		for _, w := range wanted {
+			if item == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsKind(kinds []EventKind, kind EventKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
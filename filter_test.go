@@ -0,0 +1,99 @@
+package xpd
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_NewEventFilter_validates_config(t *testing.T) {
+	invalid := []FilterConfig{
+		{FeedPairs: [][]string{{"so-sonarqube"}}},
+		{Kinds: []EventKind{"nonexistent"}},
+		{Author: "("},
+	}
+	for _, config := range invalid {
+		if _, err := NewEventFilter(config); err == nil {
+			t.Errorf("got success; expected invalid filter config to fail: %#v", config)
+		}
+	}
+}
+
+func Test_EventFilter_Accepts(t *testing.T) {
+	so := &Feed{Id: "so-sonarqube"}
+	gg := &Feed{Id: "gg-sonarqube"}
+	event := newEvent(CrossPostEvent, Post{Id: "2", Author: "jack", Feed: gg}, []Post{{Id: "1", Feed: so}})
+	event.Detector = "SimilarWordCountDetector"
+	event.Score = 0.9
+
+	accepted := []FilterConfig{
+		{},
+		{Feeds: []string{"so-sonarqube"}},
+		{Feeds: []string{"other", "gg-sonarqube"}},
+		{FeedPairs: [][]string{{"so-sonarqube", "gg-sonarqube"}}},
+		{FeedPairs: [][]string{{"gg-sonarqube", "so-sonarqube"}}},
+		{Kinds: []EventKind{CrossPostEvent}},
+		{MinScore: 0.9},
+		{Detectors: []string{"SimilarWordCountDetector"}},
+		{Author: "^ja"},
+	}
+	for _, config := range accepted {
+		filter, _ := NewEventFilter(config)
+		if !filter.Accepts(event) {
+			t.Errorf("got event rejected; expected accepted by %#v", config)
+		}
+	}
+
+	rejected := []FilterConfig{
+		{Feeds: []string{"other"}},
+		{FeedPairs: [][]string{{"so-sonarqube", "other"}}},
+		{Kinds: []EventKind{DuplicateEvent}},
+		{MinScore: 0.95},
+		{Detectors: []string{"SameBodyDetector"}},
+		{Author: "^jill$"},
+		{Feeds: []string{"so-sonarqube"}, Kinds: []EventKind{DuplicateEvent}},
+	}
+	for _, config := range rejected {
+		filter, _ := NewEventFilter(config)
+		if filter.Accepts(event) {
+			t.Errorf("got event accepted; expected rejected by %#v", config)
+		}
+	}
+}
+
+func Test_FilteredListener_notifies_only_accepted_events(t *testing.T) {
+	event := newEvent(CrossPostEvent, Post{Id: "2", Feed: &Feed{Id: "gg"}}, []Post{{Id: "1", Feed: &Feed{Id: "so"}}})
+
+	listener := &mockListener{}
+	filter, _ := NewEventFilter(FilterConfig{Kinds: []EventKind{DuplicateEvent}})
+	filtered := &FilteredListener{Listener: listener, Filter: filter}
+
+	filtered.OnEvent(context.Background(), event)
+	if listener.invokedWithCross {
+		t.Fatal("got listener invoked with cross-post; expected it filtered out")
+	}
+
+	event.Kind = DuplicateEvent
+	filtered.OnEvent(context.Background(), event)
+	if !listener.invokedWithDups {
+		t.Fatal("got listener not invoked; expected duplicate to pass the filter")
+	}
+}
+
+func Test_parseListeners_with_filter(t *testing.T) {
+	config := ListenerConfig{
+		TypeConfig: TypeConfig{Type: "gmail"},
+		Filter:     &FilterConfig{Kinds: []EventKind{CrossPostEvent}},
+	}
+	listeners, err := parseListeners([]ListenerConfig{config}, DispatchConfig{}, nil)
+	if err != nil {
+		t.Fatalf("got error: %s; expected successful parsing of filtered listener", err)
+	}
+	if _, ok := listeners[0].(*FilteredListener); !ok {
+		t.Fatalf("got %#v; expected a FilteredListener", listeners[0])
+	}
+
+	config.Filter = &FilterConfig{Author: "("}
+	if _, err := parseListeners([]ListenerConfig{config}, DispatchConfig{}, nil); err == nil {
+		t.Fatal("got success; expected parsing to fail with invalid filter")
+	}
+}
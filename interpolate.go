@@ -0,0 +1,58 @@
+package xpd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// marks configuration values read from a file, like "file:/run/secrets/gmail-pass"
+const interpolateFilePrefix = "file:"
+
+// matches references to environment variables like ${NAME}, and escaped references like $${NAME}
+var interpolateEnvPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolate resolves a configuration value: "file:path" is replaced by the content of the file,
+// without trailing newlines, and ${NAME} by the environment variable NAME, which must be set.
+// $${NAME} is replaced by a literal ${NAME}.
+func interpolate(value string) (string, error) {
+	if strings.HasPrefix(value, interpolateFilePrefix) {
+		content, err := ioutil.ReadFile(strings.TrimPrefix(value, interpolateFilePrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	var err error
+	resolved := interpolateEnvPattern.ReplaceAllStringFunc(value, func(reference string) string {
+		if strings.HasPrefix(reference, "$$") {
+			return reference[1:]
+		}
+		name := interpolateEnvPattern.FindStringSubmatch(reference)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("undefined environment variable: %s", name)
+		}
+		return env
+	})
+	if err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+// interpolateParams returns a copy of the params, with each value interpolated
+func interpolateParams(params map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(params))
+	for name, value := range params {
+		s, err := interpolate(value)
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %s", name, err)
+		}
+		resolved[name] = s
+	}
+	return resolved, nil
+}
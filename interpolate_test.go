@@ -0,0 +1,98 @@
+package xpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_interpolate_environment_variables(t *testing.T) {
+	os.Setenv("XPD_TEST_TOKEN", "s3cr3t")
+	defer os.Unsetenv("XPD_TEST_TOKEN")
+
+	for value, expected := range map[string]string{
+		"plain":                       "plain",
+		"${XPD_TEST_TOKEN}":           "s3cr3t",
+		"Bearer ${XPD_TEST_TOKEN}!":   "Bearer s3cr3t!",
+		"echo $${XPD_POST_URL} $HOME": "echo ${XPD_POST_URL} $HOME",
+	} {
+		if actual, err := interpolate(value); err != nil || actual != expected {
+			t.Errorf("got %#v, %v for %#v; expected %#v", actual, err, value, expected)
+		}
+	}
+
+	if _, err := interpolate("${XPD_TEST_UNDEFINED}"); err == nil || !strings.Contains(err.Error(), "XPD_TEST_UNDEFINED") {
+		t.Fatalf("got %v; expected the undefined variable reported", err)
+	}
+}
+
+func Test_interpolate_file(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pass")
+	if err := ioutil.WriteFile(path, []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual, err := interpolate("file:" + path); err != nil || actual != "s3cr3t" {
+		t.Fatalf("got %#v, %v; expected the content of the file", actual, err)
+	}
+	if _, err := interpolate("file:" + filepath.Join(dir, "nonexistent")); err == nil {
+		t.Fatal("got success; expected missing file to fail")
+	}
+}
+
+func Test_parseConfig_reports_interpolation_errors(t *testing.T) {
+	content := `feeds:
+  - id: so
+    url: https://example.com/feed?token=${XPD_TEST_UNDEFINED}
+detectors:
+  - type: SameBodyDetector
+listeners:
+  - type: gmail
+    params:
+      from: me
+      pass: file:/nonexistent/gmail-pass
+      recipient: you
+`
+	_, err := parseConfig("xpd.yml", []byte(content))
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 2 || errs[0].Line != 3 || errs[1].Line != 10 {
+		t.Fatalf("got %v; expected the errors of the url and the pass", err)
+	}
+}
+
+func Test_parseListener_keeps_interpolated_secrets_out_of_logs(t *testing.T) {
+	os.Setenv("XPD_TEST_PASS", "s3cr3t")
+	defer os.Unsetenv("XPD_TEST_PASS")
+
+	listener, err := parseListener(TypeConfig{Type: "gmail", Params: map[string]string{"from": "me", "pass": "${XPD_TEST_PASS}", "recipient": "you"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailer := listener.(MailerListener).Mailer
+	if s := fmt.Sprintf("%v %#v", listener, mailer); strings.Contains(s, "s3cr3t") {
+		t.Fatalf("got %s; expected the password redacted", s)
+	}
+}
+
+func Test_rssReader_errors_show_configured_url(t *testing.T) {
+	failing := func(ctx context.Context, feed Feed, uri string) ([]byte, error) {
+		return nil, &url.Error{Op: "Get", URL: uri, Err: errors.New("connection refused")}
+	}
+	reader := newRssReader("https://example.com/feed?token=s3cr3t", Feed{Url: "https://example.com/feed?token=${TOKEN}"}, failing)
+
+	_, err := reader.FetchNewPosts(context.Background())
+	if err == nil || strings.Contains(err.Error(), "s3cr3t") || !strings.Contains(err.Error(), "${TOKEN}") {
+		t.Fatalf("got %v; expected the error with the configured url", err)
+	}
+}
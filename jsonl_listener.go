@@ -0,0 +1,170 @@
+package xpd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EventSchemaVersion is incremented on incompatible changes of EventRecord
+const EventSchemaVersion = 1
+
+const defaultJsonlMaxSize = 10 * 1024 * 1024
+
+const defaultJsonlMaxBackups = 5
+
+// EventRecord is the machine-readable form of an Event, as written by JsonlListener.
+// Fields may be added without changing the schema version.
+type EventRecord struct {
+	Schema   int          `json:"schema"`
+	Kind     EventKind    `json:"kind"`
+	Time     time.Time    `json:"time"`
+	Detector string       `json:"detector"`
+	Score    float64      `json:"score"`
+	Post     PostRecord   `json:"post"`
+	Matches  []PostRecord `json:"matches"`
+	Edited   bool         `json:"edited,omitempty"`
+}
+
+type PostRecord struct {
+	Feed    string    `json:"feed"`
+	Id      string    `json:"id"`
+	Url     string    `json:"url"`
+	Author  string    `json:"author"`
+	Subject string    `json:"subject"`
+	Time    time.Time `json:"time"`
+}
+
+func newEventRecord(event Event) EventRecord {
+	matches := make([]PostRecord, len(event.Posts))
+	for i, post := range event.Posts {
+		matches[i] = newPostRecord(post)
+	}
+	return EventRecord{
+		Schema:   EventSchemaVersion,
+		Kind:     event.Kind,
+		Time:     event.Time,
+		Detector: event.Detector,
+		Score:    event.Score,
+		Post:     newPostRecord(event.Post),
+		Matches:  matches,
+		Edited:   event.Edited,
+	}
+}
+
+func newPostRecord(post Post) PostRecord {
+	return PostRecord{
+		Feed:    post.Feed.Id,
+		Id:      post.Id,
+		Url:     post.Url,
+		Author:  post.Author,
+		Subject: post.Subject,
+		Time:    post.Time,
+	}
+}
+
+// JsonlListener appends events to a file, one EventRecord per line.
+// When the file grows beyond maxSize bytes, it is rotated to path.1,
+// path.1 to path.2, and so on, keeping at most maxBackups old files.
+type JsonlListener struct {
+	Path       string
+	maxSize    int64
+	maxBackups int
+	mutex      sync.Mutex
+}
+
+func NewJsonlListener(params map[string]string) (*JsonlListener, error) {
+	listener := &JsonlListener{
+		Path:       params["path"],
+		maxSize:    defaultJsonlMaxSize,
+		maxBackups: defaultJsonlMaxBackups,
+	}
+	if listener.Path == "" {
+		return nil, errors.New("jsonl: missing path")
+	}
+
+	if s, ok := params["maxSize"]; ok {
+		value, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || value < 1 {
+			return nil, fmt.Errorf("jsonl: invalid maxSize: %s", s)
+		}
+		listener.maxSize = value
+	}
+	if s, ok := params["maxBackups"]; ok {
+		value, err := strconv.Atoi(s)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("jsonl: invalid maxBackups: %s", s)
+		}
+		listener.maxBackups = value
+	}
+
+	return listener, nil
+}
+
+func (listener *JsonlListener) OnCrossPost(ctx context.Context, post Post, posts []Post) error {
+	return listener.OnEvent(ctx, newEvent(CrossPostEvent, post, posts))
+}
+
+func (listener *JsonlListener) OnDuplicate(ctx context.Context, post Post, posts []Post) error {
+	return listener.OnEvent(ctx, newEvent(DuplicateEvent, post, posts))
+}
+
+func (listener *JsonlListener) OnEvent(ctx context.Context, event Event) error {
+	line, err := json.Marshal(newEventRecord(event))
+	if err != nil {
+		return err
+	}
+
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+
+	if err := listener.rotateIfNeeded(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(listener.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func (listener *JsonlListener) rotateIfNeeded() error {
+	info, err := os.Stat(listener.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Size() < listener.maxSize {
+		return nil
+	}
+
+	if listener.maxBackups == 0 {
+		return os.Remove(listener.Path)
+	}
+
+	os.Remove(listener.backupPath(listener.maxBackups))
+	for i := listener.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(listener.backupPath(i), listener.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(listener.Path, listener.backupPath(1))
+}
+
+func (listener *JsonlListener) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", listener.Path, i)
+}
+
+func (listener *JsonlListener) String() string {
+	return fmt.Sprintf("jsonl(%s, maxSize=%d, maxBackups=%d)", listener.Path, listener.maxSize, listener.maxBackups)
+}
@@ -0,0 +1,104 @@
+package xpd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_NewJsonlListener_validates_params(t *testing.T) {
+	invalid := []map[string]string{
+		{},
+		{"path": "events.jsonl", "maxSize": "0"},
+		{"path": "events.jsonl", "maxSize": "big"},
+		{"path": "events.jsonl", "maxBackups": "-1"},
+	}
+	for _, params := range invalid {
+		if _, err := NewJsonlListener(params); err == nil {
+			t.Errorf("got success; expected invalid params to fail: %#v", params)
+		}
+	}
+}
+
+func Test_JsonlListener_writes_event_records(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	listener, err := NewJsonlListener(map[string]string{"path": filepath.Join(dir, "events.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := Post{Id: "2", Url: "http://new", Feed: &Feed{Id: "so"}}
+	old := Post{Id: "1", Url: "http://old", Feed: &Feed{Id: "gg"}}
+	event := newEvent(CrossPostEvent, post, []Post{old})
+	event.Detector = "SameBodyDetector"
+	event.Score = 1
+
+	listener.OnEvent(context.Background(), event)
+	listener.OnDuplicate(context.Background(), post, []Post{post})
+
+	content, _ := ioutil.ReadFile(listener.Path)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines; expected 2", len(lines))
+	}
+
+	var record EventRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	expected := EventRecord{
+		Schema:   EventSchemaVersion,
+		Kind:     CrossPostEvent,
+		Time:     record.Time,
+		Detector: "SameBodyDetector",
+		Score:    1,
+		Post:     PostRecord{Feed: "so", Id: "2", Url: "http://new"},
+		Matches:  []PostRecord{{Feed: "gg", Id: "1", Url: "http://old"}},
+	}
+	if record.Post != expected.Post || record.Matches[0] != expected.Matches[0] || record.Kind != expected.Kind ||
+		record.Detector != expected.Detector || record.Score != expected.Score || record.Schema != expected.Schema {
+		t.Fatalf("got %#v; expected %#v", record, expected)
+	}
+	if time.Since(record.Time) > time.Minute {
+		t.Fatalf("got time %s; expected the time of the event", record.Time)
+	}
+}
+
+func Test_JsonlListener_rotates_files(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	listener, err := NewJsonlListener(map[string]string{"path": filepath.Join(dir, "events.jsonl"), "maxSize": "1", "maxBackups": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := Post{Id: "1", Feed: &Feed{Id: "so"}}
+	for i := 0; i < 4; i++ {
+		if err := listener.OnDuplicate(context.Background(), post, []Post{post}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{listener.Path, listener.Path + ".1", listener.Path + ".2"} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("got %s; expected rotated file to exist", err)
+		}
+	}
+	if _, err := os.Stat(listener.Path + ".3"); !os.IsNotExist(err) {
+		t.Error("got more backups than maxBackups")
+	}
+}
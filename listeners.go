@@ -1,6 +1,7 @@
 package xpd
 
 import (
+	"context"
 	"fmt"
 	"github.com/xpd-org/xpd/mail"
 	"log"
@@ -8,37 +9,65 @@ import (
 
 type ConsolePrinterListener struct{}
 
-func (listener ConsolePrinterListener) OnCrossPost(post Post, posts []Post) {
+func (listener ConsolePrinterListener) OnCrossPost(ctx context.Context, post Post, posts []Post) error {
 	log.Printf("possible cross-post:\n%s", summaryOfPosts(post, posts))
+	return nil
 }
 
-func (listener ConsolePrinterListener) OnDuplicate(post Post, posts []Post) {
+func (listener ConsolePrinterListener) OnDuplicate(ctx context.Context, post Post, posts []Post) error {
 	log.Printf("possible duplicate:\n%s", summaryOfPosts(post, posts))
+	return nil
 }
 
 type MailerListener struct {
 	Mailer mail.Mailer
 }
 
-func (listener MailerListener) OnCrossPost(post Post, posts []Post) {
+func (listener MailerListener) OnCrossPost(ctx context.Context, post Post, posts []Post) error {
 	log.Println("sending email about cross-post:", post.Id)
-	listener.send("possible cross-post:", post, posts)
+	return listener.send("possible cross-post:", post, posts)
 }
 
-func (listener MailerListener) OnDuplicate(post Post, posts []Post) {
+func (listener MailerListener) OnDuplicate(ctx context.Context, post Post, posts []Post) error {
 	log.Println("sending email about duplicate post:", post.Id)
-	listener.send("possible duplicate:", post, posts)
+	return listener.send("possible duplicate:", post, posts)
 }
 
-func (listener MailerListener) send(subject string, post Post, posts []Post) {
+// OnDigest sends all events in a single email, in sections per feed pair
+func (listener MailerListener) OnDigest(ctx context.Context, events []Event) error {
+	log.Printf("sending email about %d event(s)", len(events))
+
+	// start message with empty line to avoid interpretation as header fields
+	message := "\n\n"
+	message += fmt.Sprintf("digest of %d event(s):\n", len(events))
+
+	section := ""
+	for _, event := range events {
+		if feedPair := event.feedPair(); feedPair != section {
+			section = feedPair
+			message += fmt.Sprintf("\n== %s ==\n", section)
+		}
+		message += fmt.Sprintf("\npossible %s:\n", event.Kind)
+		message += summaryOfPosts(event.Post, event.Posts)
+	}
+
+	return listener.sendMessage(message)
+}
+
+func (listener MailerListener) send(subject string, post Post, posts []Post) error {
 	// start message with empty line to avoid interpretation as header fields
 	message := "\n\n"
 	message += subject + "\n\n"
 	message += summaryOfPosts(post, posts)
 
+	return listener.sendMessage(message)
+}
+
+func (listener MailerListener) sendMessage(message string) error {
 	if err := listener.Mailer.Send(message); err != nil {
-		log.Printf("smtp error: %s", err)
+		return fmt.Errorf("smtp error: %s", err)
 	}
+	return nil
 }
 
 func summaryOfPosts(post Post, oldPosts []Post) string {
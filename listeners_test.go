@@ -1,6 +1,7 @@
 package xpd
 
 import (
+	"context"
 	"github.com/xpd-org/xpd/mail"
 	"testing"
 )
@@ -8,7 +9,7 @@ import (
 func Test_consolePrinterListener_should_crash_on_Post_without_Feed(t *testing.T) {
 	postWithoutFeed := Post{Subject: "dummyPost"}
 	assertPanic(t, "did not crash on Post without Feed, but it should have", func() {
-		ConsolePrinterListener{}.OnDuplicate(postWithoutFeed, []Post{{}})
+		ConsolePrinterListener{}.OnDuplicate(context.Background(), postWithoutFeed, []Post{{}})
 	})
 }
 
@@ -17,18 +18,18 @@ func Test_consolePrinterListener_should_crash_on_duplicate_Post_without_Feed(t *
 	postWithoutFeed := Post{}
 
 	assertPanic(t, "did not crash on Post without Feed, but it should have", func() {
-		ConsolePrinterListener{}.OnDuplicate(postWithFeed, []Post{postWithoutFeed})
+		ConsolePrinterListener{}.OnDuplicate(context.Background(), postWithFeed, []Post{postWithoutFeed})
 	})
 }
 
 func Test_consolePrinterListener_happy_path_duplicate(t *testing.T) {
 	postWithFeed := Post{Subject: "dummyPost", Feed: &Feed{Id: "dummyFeed"}}
-	ConsolePrinterListener{}.OnDuplicate(postWithFeed, []Post{postWithFeed})
+	ConsolePrinterListener{}.OnDuplicate(context.Background(), postWithFeed, []Post{postWithFeed})
 }
 
 func Test_consolePrinterListener_happy_path_cross(t *testing.T) {
 	postWithFeed := Post{Subject: "dummyPost", Feed: &Feed{Id: "dummyFeed"}}
-	ConsolePrinterListener{}.OnCrossPost(postWithFeed, []Post{postWithFeed})
+	ConsolePrinterListener{}.OnCrossPost(context.Background(), postWithFeed, []Post{postWithFeed})
 }
 
 func Test_summaryOfPost(t *testing.T) {
@@ -46,7 +47,7 @@ func Test_MailerListener_success_duplicate(t *testing.T) {
 
 	mailer := &mail.MockMailer{}
 	listener := MailerListener{Mailer: mailer}
-	listener.OnDuplicate(postWithFeed, []Post{postWithFeed})
+	listener.OnDuplicate(context.Background(), postWithFeed, []Post{postWithFeed})
 
 	if mailer.Message == "" {
 		t.Fatal("got empty mock message; should have been set by OnDuplicate")
@@ -58,7 +59,7 @@ func Test_MailerListener_success_cross(t *testing.T) {
 
 	mailer := &mail.MockMailer{}
 	listener := MailerListener{Mailer: mailer}
-	listener.OnCrossPost(postWithFeed, []Post{postWithFeed})
+	listener.OnCrossPost(context.Background(), postWithFeed, []Post{postWithFeed})
 
 	if mailer.Message == "" {
 		t.Fatal("got empty mock message; should have been set by OnDuplicate")
@@ -69,7 +70,7 @@ func Test_MailerListener_fail(t *testing.T) {
 	postWithFeed := Post{Subject: "dummyPost", Feed: &Feed{Id: "dummyFeed"}}
 
 	listener := MailerListener{Mailer: mail.NullMailer{}}
-	listener.OnDuplicate(postWithFeed, []Post{postWithFeed})
-
-	// TODO verify the error in the listener logs
+	if err := listener.OnDuplicate(context.Background(), postWithFeed, []Post{postWithFeed}); err == nil {
+		t.Fatal("got success; expected the mailer error to be returned")
+	}
 }
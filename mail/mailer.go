@@ -4,6 +4,7 @@ import (
 	"github.com/SlyMarbo/gmail"
 	"errors"
 	"fmt"
+	"github.com/xpd-org/xpd/secret"
 )
 
 type Mailer interface {
@@ -27,7 +28,7 @@ func (mailer NullMailer) Send(string) error {
 
 type GmailMailer struct {
 	From      string
-	Pass      string
+	Pass      secret.Value
 	Recipient string
 	Subject   string
 }
@@ -35,7 +36,7 @@ type GmailMailer struct {
 func (mailer GmailMailer) Send(message string) error {
 	email := gmail.Compose(mailer.Subject, message)
 	email.From = mailer.From
-	email.Password = mailer.Pass
+	email.Password = string(mailer.Pass)
 
 	// Defaults to "text/plain; charset=utf-8" if unset.
 	//email.ContentType = "text/html; charset=utf-8"
@@ -49,7 +50,6 @@ func (mailer GmailMailer) Send(message string) error {
 func (mailer GmailMailer) String() string {
 	safeMailer := mailer
 	safeMailer.From = "*"
-	safeMailer.Pass = "*"
 	safeMailer.Recipient = "*"
 	return fmt.Sprintf("%#v", safeMailer)
 }
@@ -1,6 +1,7 @@
 package mail
 
 import (
+	"github.com/xpd-org/xpd/secret"
 	"testing"
 )
 
@@ -23,7 +24,7 @@ func Test_NullMailer_send(t *testing.T) {
 }
 
 func Test_GmailMailer_String_should_hide_password(t *testing.T) {
-	pass := "pass"
+	pass := secret.Value("pass")
 	mailer := GmailMailer{From: "from", Pass: pass}
 
 	expected := `mail.GmailMailer{From:"*", Pass:"*", Recipient:"*", Subject:""}`
@@ -32,6 +33,6 @@ func Test_GmailMailer_String_should_hide_password(t *testing.T) {
 		t.Fatalf("got %s, expected %s", s, expected)
 	}
 	if mailer.Pass != pass {
-		t.Fatalf("got mailer.Pass=%s; expected %s", mailer.Pass, pass)
+		t.Fatalf("got mailer.Pass=%s; expected %s", string(mailer.Pass), string(pass))
 	}
 }
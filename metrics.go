@@ -0,0 +1,258 @@
+package xpd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var fetchDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+var detectorDurationBuckets = []float64{0.0001, 0.001, 0.01, 0.1, 1, 10}
+
+// Metrics is a minimal registry of counters, gauges and histograms,
+// exposed in the Prometheus text format.
+// The methods do nothing on a nil *Metrics, so that instrumentation is optional.
+type Metrics struct {
+	mutex    sync.Mutex
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	values  map[string]*metricValue
+}
+
+type metricValue struct {
+	labelValues []string
+	value       float64
+	// histograms only: cumulative counts per bucket, sum and count of observations
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewMetrics() *Metrics {
+	metrics := &Metrics{families: make(map[string]*metricFamily)}
+
+	metrics.register("xpd_feed_fetches_total", "Number of fetches of a feed.", "counter", nil, "feed")
+	metrics.register("xpd_feed_fetch_errors_total", "Number of failed fetches of a feed.", "counter", nil, "feed")
+	metrics.register("xpd_feed_fetch_duration_seconds", "Duration of fetches of a feed.", "histogram", fetchDurationBuckets, "feed")
+	metrics.register("xpd_posts_ingested_total", "Number of new posts processed.", "counter", nil, "feed")
+	metrics.register("xpd_posts_edited_total", "Number of edited posts processed again.", "counter", nil, "feed")
+	metrics.register("xpd_detector_duration_seconds", "Duration of searching matches of a new post.", "histogram", detectorDurationBuckets, "detector")
+	metrics.register("xpd_detector_matches_total", "Number of events found by a detector.", "counter", nil, "detector", "kind")
+	metrics.register("xpd_suppressed_matches_total", "Number of posts with matches suppressed, by detector.", "counter", nil, "detector")
+	metrics.register("xpd_listener_deliveries_total", "Number of events delivered to a listener.", "counter", nil, "listener")
+	metrics.register("xpd_listener_retries_total", "Number of retried deliveries to a listener.", "counter", nil, "listener")
+	metrics.register("xpd_listener_failures_total", "Number of events that could not be delivered to a listener.", "counter", nil, "listener")
+	metrics.register("xpd_listener_queue_depth", "Number of deliveries waiting in the queue of a listener.", "gauge", nil, "listener")
+	metrics.register("xpd_repository_posts", "Number of posts stored in the repository.", "gauge", nil, "feed")
+	metrics.register("xpd_repository_evictions_total", "Number of posts evicted from the repository, by retention policy.", "counter", nil, "feed", "reason")
+
+	return metrics
+}
+
+func (metrics *Metrics) register(name, help, kind string, buckets []float64, labels ...string) {
+	metrics.families[name] = &metricFamily{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*metricValue),
+	}
+}
+
+func (metrics *Metrics) value(name string, labelValues []string) *metricValue {
+	family, ok := metrics.families[name]
+	if !ok {
+		panic("unregistered metric: " + name)
+	}
+	if len(labelValues) != len(family.labels) {
+		panic(fmt.Sprintf("metric %s needs labels %v, got %v", name, family.labels, labelValues))
+	}
+
+	key := strings.Join(labelValues, "\x00")
+	value, ok := family.values[key]
+	if !ok {
+		value = &metricValue{labelValues: labelValues}
+		if family.kind == "histogram" {
+			value.counts = make([]uint64, len(family.buckets))
+		}
+		family.values[key] = value
+	}
+	return value
+}
+
+// Add increments a counter
+func (metrics *Metrics) Add(name string, delta float64, labelValues ...string) {
+	if metrics == nil {
+		return
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.value(name, labelValues).value += delta
+}
+
+// Set sets the value of a gauge, or of a counter kept elsewhere
+func (metrics *Metrics) Set(name string, value float64, labelValues ...string) {
+	if metrics == nil {
+		return
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.value(name, labelValues).value = value
+}
+
+// Reset removes all the values of a metric, like those of feeds no longer configured
+func (metrics *Metrics) Reset(name string) {
+	if metrics == nil {
+		return
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.families[name].values = make(map[string]*metricValue)
+}
+
+// Observe records a value in a histogram
+func (metrics *Metrics) Observe(name string, observed float64, labelValues ...string) {
+	if metrics == nil {
+		return
+	}
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	value := metrics.value(name, labelValues)
+	for i, bound := range metrics.families[name].buckets {
+		if observed <= bound {
+			value.counts[i]++
+		}
+	}
+	value.sum += observed
+	value.count++
+}
+
+// ObserveSince records the seconds elapsed since start in a histogram
+func (metrics *Metrics) ObserveSince(name string, start time.Time, labelValues ...string) {
+	metrics.Observe(name, time.Since(start).Seconds(), labelValues...)
+}
+
+// Get returns the value of a counter or gauge, for tests
+func (metrics *Metrics) Get(name string, labelValues ...string) float64 {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	return metrics.value(name, labelValues).value
+}
+
+// WriteTo writes all the metrics in the Prometheus text format
+func (metrics *Metrics) WriteTo(w io.Writer) (int64, error) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	var names []string
+	for name := range metrics.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		family := metrics.families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, family.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, family.kind)
+
+		var keys []string
+		for key := range family.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			value := family.values[key]
+			labels := formatLabels(family.labels, value.labelValues)
+			if family.kind != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", name, labels, formatFloat(value.value))
+				continue
+			}
+			for i, bound := range family.buckets {
+				bucketLabels := formatLabels(append(family.labels, "le"), append(value.labelValues, formatFloat(bound)))
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, bucketLabels, value.counts[i])
+			}
+			infLabels := formatLabels(append(family.labels, "le"), append(value.labelValues, "+Inf"))
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, infLabels, value.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, labels, formatFloat(value.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, labels, value.count)
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// metricsHandler serves the metrics, after updating those that reflect the current state
+func metricsHandler(context *Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics := context.Metrics
+		if metrics == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		stored := make(map[string]int)
+		for _, post := range context.PostRepository.FindRecent() {
+			stored[post.feedId()]++
+		}
+		// without the feeds whose posts were all evicted
+		metrics.Reset("xpd_repository_posts")
+		for feedId, count := range stored {
+			metrics.Set("xpd_repository_posts", float64(count), feedId)
+		}
+
+		_, listeners := context.components()
+		// the counters of deliveries are added to by the queues, across reloads
+		for _, queue := range findQueues(listeners) {
+			metrics.Set("xpd_listener_queue_depth", float64(queue.Stats().Depth), queue.name())
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.WriteTo(w)
+	}
+}
+
+// findQueues finds the QueuedListeners among listeners, including those wrapped by others
+func findQueues(listeners []Listener) []*QueuedListener {
+	var queues []*QueuedListener
+	for _, listener := range listeners {
+		for ; listener != nil; listener = unwrapListener(listener) {
+			if queue, ok := listener.(*QueuedListener); ok {
+				queues = append(queues, queue)
+			}
+		}
+	}
+	return queues
+}
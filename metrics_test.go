@@ -0,0 +1,122 @@
+package xpd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Metrics_WriteTo_text_format(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.Add("xpd_feed_fetches_total", 1, "so")
+	metrics.Add("xpd_feed_fetches_total", 2, "gg")
+	metrics.Observe("xpd_feed_fetch_duration_seconds", 0.3, "so")
+	metrics.Observe("xpd_feed_fetch_duration_seconds", 60, "so")
+
+	var b strings.Builder
+	metrics.WriteTo(&b)
+	text := b.String()
+
+	for _, expected := range []string{
+		"# TYPE xpd_feed_fetches_total counter\nxpd_feed_fetches_total{feed=\"gg\"} 2\nxpd_feed_fetches_total{feed=\"so\"} 1\n",
+		"# TYPE xpd_feed_fetch_duration_seconds histogram\n",
+		"xpd_feed_fetch_duration_seconds_bucket{feed=\"so\",le=\"0.25\"} 0\n",
+		"xpd_feed_fetch_duration_seconds_bucket{feed=\"so\",le=\"0.5\"} 1\n",
+		"xpd_feed_fetch_duration_seconds_bucket{feed=\"so\",le=\"30\"} 1\n",
+		"xpd_feed_fetch_duration_seconds_bucket{feed=\"so\",le=\"+Inf\"} 2\n",
+		"xpd_feed_fetch_duration_seconds_sum{feed=\"so\"} 60.3\n",
+		"xpd_feed_fetch_duration_seconds_count{feed=\"so\"} 2\n",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("got metrics without %#v:\n%s", expected, text)
+		}
+	}
+}
+
+func Test_Metrics_nil_does_nothing(t *testing.T) {
+	var metrics *Metrics
+	metrics.Add("xpd_feed_fetches_total", 1, "so")
+	metrics.ObserveSince("xpd_feed_fetch_duration_seconds", time.Now(), "so")
+}
+
+func Test_monitoredReader_records_metrics(t *testing.T) {
+	metrics := NewMetrics()
+	newMonitoredReader(&mockReader{}, NewFeedMonitor(), metrics).FetchNewPosts(context.Background())
+	newMonitoredReader(&failingReader{}, NewFeedMonitor(), metrics).FetchNewPosts(context.Background())
+
+	if value := metrics.Get("xpd_feed_fetches_total", "dummy"); value != 2 {
+		t.Fatalf("got %v fetches; expected 2", value)
+	}
+	if value := metrics.Get("xpd_feed_fetch_errors_total", "dummy"); value != 1 {
+		t.Fatalf("got %v fetch errors; expected 1", value)
+	}
+}
+
+func Test_processNewPost_records_metrics(t *testing.T) {
+	metrics := NewMetrics()
+	ctx := context.Background()
+	context := &Context{
+		Detectors:      []Detector{SameBodyDetector{}},
+		PostRepository: NewPostRepository(),
+		Metrics:        metrics,
+	}
+
+	feed := &Feed{Id: "p1"}
+	processNewPost(ctx, context, Post{Id: "1", Body: "hello", Feed: feed})
+	processNewPost(ctx, context, Post{Id: "2", Body: "hello", Feed: feed})
+
+	if value := metrics.Get("xpd_posts_ingested_total", "p1"); value != 2 {
+		t.Fatalf("got %v posts ingested; expected 2", value)
+	}
+	if value := metrics.Get("xpd_detector_matches_total", "SameBodyDetector", "duplicate"); value != 1 {
+		t.Fatalf("got %v matches; expected 1", value)
+	}
+}
+
+func Test_metrics_endpoint(t *testing.T) {
+	ctx := context.Background()
+	context := newDashboardTestContext()
+	context.Metrics = NewMetrics()
+	event := Event{Kind: CrossPostEvent, Post: Post{Feed: &Feed{Id: "so"}}}
+
+	// the queue of the listener before a reload
+	previous := NewQueuedListener(&flakyListener{}, DispatchConfig{})
+	previous.Name, previous.Metrics = "flaky-1", context.Metrics
+	previous.OnEvent(ctx, event)
+	previous.Close()
+
+	queue := NewQueuedListener(&flakyListener{}, DispatchConfig{})
+	queue.Name, queue.Metrics = "flaky-1", context.Metrics
+	defer queue.Close()
+	context.Listeners = []Listener{&FilteredListener{Listener: queue, Filter: &EventFilter{}}}
+
+	queue.OnEvent(ctx, event)
+	for deadline := time.Now().Add(time.Second); queue.Stats().Delivered == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	// a feed whose posts were all evicted since the previous scrape
+	context.Metrics.Set("xpd_repository_posts", 3, "evicted")
+
+	recorder := get(t, context, "/metrics")
+	body := recorder.Body.String()
+	if strings.Contains(body, `feed="evicted"`) {
+		t.Errorf("got metrics with the count of a feed without posts:\n%s", body)
+	}
+	for _, expected := range []string{
+		"xpd_repository_posts{feed=\"gg-sonarqube\"} 1\n",
+		"xpd_listener_deliveries_total{listener=\"flaky-1\"} 2\n",
+		"xpd_listener_queue_depth{listener=\"flaky-1\"} 0\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("got metrics without %#v:\n%s", expected, body)
+		}
+	}
+}
+
+func Test_metrics_endpoint_without_metrics(t *testing.T) {
+	if recorder := get(t, newDashboardTestContext(), "/metrics"); recorder.Code != 404 {
+		t.Fatalf("got status %d; expected 404", recorder.Code)
+	}
+}
@@ -0,0 +1,121 @@
+package xpd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FeedStatus is the health of a feed, as seen by its reader
+type FeedStatus struct {
+	Feed          Feed
+	Fetches       int
+	Errors        int
+	Posts         int
+	LastFetch     time.Time
+	LastSuccess   time.Time
+	LastError     string
+	LastErrorTime time.Time
+}
+
+// Healthy is true if the last fetch was successful
+func (status FeedStatus) Healthy() bool {
+	return status.Fetches > 0 && !status.LastSuccess.Before(status.LastFetch)
+}
+
+// FeedMonitor keeps track of the status of each feed
+type FeedMonitor struct {
+	mutex    sync.Mutex
+	statuses map[string]*FeedStatus
+	order    []string
+}
+
+func NewFeedMonitor() *FeedMonitor {
+	return &FeedMonitor{statuses: make(map[string]*FeedStatus)}
+}
+
+func (monitor *FeedMonitor) add(feed Feed) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+	if _, ok := monitor.statuses[feed.Id]; !ok {
+		monitor.statuses[feed.Id] = &FeedStatus{Feed: feed}
+		monitor.order = append(monitor.order, feed.Id)
+	}
+}
+
+func (monitor *FeedMonitor) remove(feed Feed) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+	if _, ok := monitor.statuses[feed.Id]; !ok {
+		return
+	}
+	delete(monitor.statuses, feed.Id)
+	for i, id := range monitor.order {
+		if id == feed.Id {
+			monitor.order = append(monitor.order[:i:i], monitor.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (monitor *FeedMonitor) record(feed Feed, posts int, err error) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	status, ok := monitor.statuses[feed.Id]
+	if !ok {
+		status = &FeedStatus{Feed: feed}
+		monitor.statuses[feed.Id] = status
+		monitor.order = append(monitor.order, feed.Id)
+	}
+
+	now := time.Now()
+	status.Fetches++
+	status.LastFetch = now
+	if err != nil {
+		status.Errors++
+		status.LastError = err.Error()
+		status.LastErrorTime = now
+	} else {
+		status.LastSuccess = now
+		status.Posts += posts
+	}
+}
+
+// Statuses returns a snapshot of the status of the feeds, in the order they were added
+func (monitor *FeedMonitor) Statuses() []FeedStatus {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+	statuses := make([]FeedStatus, len(monitor.order))
+	for i, id := range monitor.order {
+		statuses[i] = *monitor.statuses[id]
+	}
+	return statuses
+}
+
+// monitoredReader records the outcome of each fetch of a FeedReader in a FeedMonitor,
+// and in Metrics if not nil
+type monitoredReader struct {
+	FeedReader
+	monitor *FeedMonitor
+	metrics *Metrics
+}
+
+func newMonitoredReader(reader FeedReader, monitor *FeedMonitor, metrics *Metrics) FeedReader {
+	monitor.add(reader.GetFeed())
+	return &monitoredReader{FeedReader: reader, monitor: monitor, metrics: metrics}
+}
+
+func (reader *monitoredReader) FetchNewPosts(ctx context.Context) ([]Post, error) {
+	start := time.Now()
+	posts, err := reader.FeedReader.FetchNewPosts(ctx)
+
+	feed := reader.GetFeed()
+	reader.monitor.record(feed, len(posts), err)
+	reader.metrics.Add("xpd_feed_fetches_total", 1, feed.Id)
+	reader.metrics.ObserveSince("xpd_feed_fetch_duration_seconds", start, feed.Id)
+	if err != nil {
+		reader.metrics.Add("xpd_feed_fetch_errors_total", 1, feed.Id)
+	}
+	return posts, err
+}
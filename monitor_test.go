@@ -0,0 +1,56 @@
+package xpd
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type failingReader struct {
+	mockReader
+}
+
+func (reader *failingReader) FetchNewPosts(ctx context.Context) ([]Post, error) {
+	return nil, errors.New("dummy failure")
+}
+
+func Test_monitoredReader_records_fetches(t *testing.T) {
+	monitor := NewFeedMonitor()
+	reader := newMonitoredReader(&mockReader{}, monitor, nil)
+
+	if statuses := monitor.Statuses(); len(statuses) != 1 || statuses[0].Healthy() {
+		t.Fatalf("got %#v; expected 1 feed waiting for the first fetch", statuses)
+	}
+
+	reader.FetchNewPosts(context.Background())
+	status := monitor.Statuses()[0]
+	if !status.Healthy() || status.Fetches != 1 || status.Posts != 1 || status.Errors != 0 {
+		t.Fatalf("got %#v; expected 1 healthy fetch with 1 post", status)
+	}
+}
+
+func Test_monitoredReader_records_errors(t *testing.T) {
+	monitor := NewFeedMonitor()
+	reader := newMonitoredReader(&failingReader{}, monitor, nil)
+
+	if _, err := reader.FetchNewPosts(context.Background()); err == nil {
+		t.Fatal("got success; expected the error of the reader")
+	}
+	status := monitor.Statuses()[0]
+	if status.Healthy() || status.Errors != 1 || status.LastError != "dummy failure" {
+		t.Fatalf("got %#v; expected 1 failed fetch", status)
+	}
+}
+
+func Test_FeedMonitor_keeps_order_of_feeds(t *testing.T) {
+	monitor := NewFeedMonitor()
+	monitor.add(Feed{Id: "b"})
+	monitor.add(Feed{Id: "a"})
+	monitor.record(Feed{Id: "c"}, 0, nil)
+	monitor.add(Feed{Id: "b"})
+
+	statuses := monitor.Statuses()
+	if len(statuses) != 3 || statuses[0].Feed.Id != "b" || statuses[1].Feed.Id != "a" || statuses[2].Feed.Id != "c" {
+		t.Fatalf("got %#v; expected feeds b, a, c", statuses)
+	}
+}
@@ -0,0 +1,122 @@
+package xpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// runOnceAndShutdown fetches each feed once, processes the new posts, and shuts down,
+// returning an error if any feed could not be fetched
+func runOnceAndShutdown(config *Config, options RunOptions) error {
+	if options.Backfill && config.Repository.File == "" {
+		return errors.New("backfill: configure repository.file to keep the posts")
+	}
+	xpdContext, err := newContext(config, options.fetch())
+	if err != nil {
+		return err
+	}
+	if options.Backfill {
+		backfillReaders(xpdContext)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	runErr := runOnce(ctx, xpdContext)
+	stop()
+
+	return shutdownAfterRun(xpdContext, runErr)
+}
+
+// shutdownAfterRun shuts down the context, returning the error of the run if any, else of the shutdown
+func shutdownAfterRun(xpdContext *Context, runErr error) error {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), xpdContext.config.shutdownTimeout())
+	defer cancel()
+	shutdownErr := xpdContext.Shutdown(shutdownCtx)
+
+	if runErr != nil {
+		return runErr
+	}
+	return shutdownErr
+}
+
+// runOnce fetches each feed once, in parallel, and processes the new posts in order of publication.
+// If some feeds could not be fetched, the posts of the others are processed, and an error is returned.
+func runOnce(ctx context.Context, context *Context) error {
+	readers := context.Readers
+	fetched := make([][]Post, len(readers))
+	errs := make([]error, len(readers))
+
+	var wg sync.WaitGroup
+	for i, reader := range readers {
+		wg.Add(1)
+		go func(i int, reader FeedReader) {
+			defer wg.Done()
+			fetched[i], errs[i] = reader.FetchNewPosts(ctx)
+		}(i, reader)
+	}
+	wg.Wait()
+
+	var posts []Post
+	var failed []string
+	for i, reader := range readers {
+		if errs[i] != nil {
+			log.Printf("error: %s", errs[i])
+			failed = append(failed, reader.GetFeed().Id)
+		}
+		posts = append(posts, fetched[i]...)
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Time.Before(posts[j].Time)
+	})
+
+	for _, post := range posts {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		processNewPost(ctx, context, post)
+	}
+	log.Printf("processed %d new post(s) of %d feed(s)", len(posts), len(readers))
+
+	if len(failed) > 0 {
+		return fmt.Errorf("could not fetch feed(s): %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// backfillReaders makes the first successful fetch of each reader add the posts to the repository,
+// without detecting matches
+func backfillReaders(xpdContext *Context) {
+	xpdContext.backfill = true
+	for i, reader := range xpdContext.Readers {
+		xpdContext.Readers[i] = &backfillReader{FeedReader: reader, repo: xpdContext.PostRepository}
+	}
+}
+
+// backfillReader adds the posts of its first successful fetch to the repository, returning none,
+// so that the posts already in a feed are compared with, but not reported
+type backfillReader struct {
+	FeedReader
+	repo PostRepository
+	done bool
+}
+
+func (reader *backfillReader) FetchNewPosts(ctx context.Context) ([]Post, error) {
+	posts, err := reader.FeedReader.FetchNewPosts(ctx)
+	if reader.done || err != nil {
+		return posts, err
+	}
+	reader.done = true
+
+	for _, post := range posts {
+		reader.repo.Add(post)
+	}
+	log.Printf("backfilled %d post(s) of %s", len(posts), reader.GetFeed().Id)
+	return nil, nil
+}
@@ -0,0 +1,92 @@
+package xpd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// returns the same posts on each fetch
+type staticReader struct {
+	feed  Feed
+	posts []Post
+}
+
+func (reader *staticReader) GetFeed() Feed {
+	return reader.feed
+}
+
+func (reader *staticReader) FetchNewPosts(ctx context.Context) ([]Post, error) {
+	return reader.posts, nil
+}
+
+func newStaticReader(id string, posts ...Post) *staticReader {
+	reader := &staticReader{feed: Feed{Id: id}}
+	for _, post := range posts {
+		post.Feed = &reader.feed
+		reader.posts = append(reader.posts, post)
+	}
+	return reader
+}
+
+func Test_runOnce_processes_posts_in_order_of_publication(t *testing.T) {
+	now := time.Now()
+	events := NewEventStore()
+	ctx := context.Background()
+	context := &Context{
+		Readers: []FeedReader{
+			newStaticReader("newer", Post{Id: "2", Body: "hello", Time: now}),
+			newStaticReader("older", Post{Id: "1", Body: "hello", Time: now.Add(-time.Hour)}),
+		},
+		Detectors:      []Detector{SameBodyDetector{}},
+		Listeners:      []Listener{events},
+		PostRepository: NewPostRepository(),
+	}
+
+	if err := runOnce(ctx, context); err != nil {
+		t.Fatal(err)
+	}
+
+	recent := events.FindRecent()
+	if len(recent) != 1 || recent[0].Post.Id != "2" || recent[0].Kind != CrossPostEvent {
+		t.Fatalf("got %#v; expected the newer post reported as cross-post", recent)
+	}
+}
+
+func Test_runOnce_fails_if_a_feed_fails(t *testing.T) {
+	repo := NewPostRepository()
+	ctx := context.Background()
+	context := &Context{
+		Readers:        []FeedReader{&failingReader{}, newStaticReader("ok", Post{Id: "1"})},
+		Detectors:      []Detector{SameBodyDetector{}},
+		PostRepository: repo,
+	}
+
+	if err := runOnce(ctx, context); err == nil {
+		t.Fatal("got success; expected the failed fetch reported")
+	}
+	if len(repo.FindRecent()) != 1 {
+		t.Fatalf("got %#v; expected the posts of the other feed processed", repo.FindRecent())
+	}
+}
+
+func Test_backfillReader_adds_first_posts_without_returning_them(t *testing.T) {
+	repo := NewPostRepository()
+	reader := &backfillReader{FeedReader: newStaticReader("so", Post{Id: "1"}), repo: repo}
+
+	if posts, err := reader.FetchNewPosts(context.Background()); err != nil || len(posts) != 0 {
+		t.Fatalf("got %#v, %v; expected no new posts on the first fetch", posts, err)
+	}
+	if recent := repo.FindRecent(); len(recent) != 1 || recent[0].Id != "1" {
+		t.Fatalf("got %#v; expected the posts of the first fetch in the repository", recent)
+	}
+	if posts, _ := reader.FetchNewPosts(context.Background()); len(posts) != 1 {
+		t.Fatalf("got %#v; expected the new posts of later fetches", posts)
+	}
+}
+
+func Test_runOnceAndShutdown_backfill_requires_repository_file(t *testing.T) {
+	if err := runOnceAndShutdown(&Config{Feeds: []Feed{{Id: "a", Url: "http://localhost/a"}}, Detectors: []TypeConfig{{Type: "SameBodyDetector"}}}, RunOptions{Once: true, Backfill: true}); err == nil {
+		t.Fatal("got success; expected backfill without repository file to fail")
+	}
+}
@@ -0,0 +1,198 @@
+package xpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// the name of a recorded document is the time it was fetched, in this layout, so that names sort by time
+const recordingTimeLayout = "20060102T150405.000000000Z"
+
+const recordingExt = ".xml"
+
+// recording is a document fetched for a feed, saved in a file
+type recording struct {
+	feedId string
+	time   time.Time
+	path   string
+}
+
+// recordFetches saves each document fetched successfully to dir/{feed id}/{time}.xml, to replay later.
+// Failing to save is logged, without failing the fetch.
+func recordFetches(dir string, fetch fetchFunc) fetchFunc {
+	return func(ctx context.Context, feed Feed, uri string) ([]byte, error) {
+		content, err := fetch(ctx, feed, uri)
+		if err != nil {
+			return content, err
+		}
+		if err := saveRecording(dir, feed.Id, time.Now(), content); err != nil {
+			log.Printf("error: could not record %s: %s", feed.Id, err)
+		}
+		return content, nil
+	}
+}
+
+// recordingDir is the directory of the recordings of a feed, its id escaped to be a valid name
+func recordingDir(dir, feedId string) string {
+	return filepath.Join(dir, url.PathEscape(feedId))
+}
+
+func saveRecording(dir, feedId string, t time.Time, content []byte) error {
+	feedDir := recordingDir(dir, feedId)
+	if err := os.MkdirAll(feedDir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(feedDir, t.UTC().Format(recordingTimeLayout)+recordingExt)
+
+	// written completely before appearing with its name, to replay while recording
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// listRecordings returns the recordings of the feeds in dir, in order of time
+func listRecordings(dir string, feeds []Feed) ([]recording, error) {
+	var recordings []recording
+	for _, feed := range feeds {
+		feedDir := recordingDir(dir, feed.Id)
+		files, err := ioutil.ReadDir(feedDir)
+		if os.IsNotExist(err) {
+			log.Printf("no recordings of feed: %s", feed.Id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			name := file.Name()
+			if file.IsDir() || !strings.HasSuffix(name, recordingExt) {
+				continue
+			}
+			t, err := time.Parse(recordingTimeLayout, strings.TrimSuffix(name, recordingExt))
+			if err != nil {
+				return nil, fmt.Errorf("invalid recording name, expected the time like %s: %s",
+					recordingTimeLayout+recordingExt, filepath.Join(feedDir, name))
+			}
+			recordings = append(recordings, recording{feedId: feed.Id, time: t, path: filepath.Join(feedDir, name)})
+		}
+	}
+	if len(recordings) == 0 {
+		return nil, fmt.Errorf("no recordings of the configured feeds in: %s", dir)
+	}
+
+	sort.SliceStable(recordings, func(i, j int) bool {
+		return recordings[i].time.Before(recordings[j].time)
+	})
+	return recordings, nil
+}
+
+// replayer serves the recordings of each feed in order, one per fetch
+type replayer struct {
+	mutex   sync.Mutex
+	pending map[string][]recording
+}
+
+func newReplayer(recordings []recording) *replayer {
+	pending := make(map[string][]recording)
+	for _, recording := range recordings {
+		pending[recording.feedId] = append(pending[recording.feedId], recording)
+	}
+	return &replayer{pending: pending}
+}
+
+func (replayer *replayer) fetch(ctx context.Context, feed Feed, uri string) ([]byte, error) {
+	replayer.mutex.Lock()
+	pending := replayer.pending[feed.Id]
+	if len(pending) == 0 {
+		replayer.mutex.Unlock()
+		return nil, errors.New("no more recordings")
+	}
+	next := pending[0]
+	replayer.pending[feed.Id] = pending[1:]
+	replayer.mutex.Unlock()
+
+	return ioutil.ReadFile(next.path)
+}
+
+// NewReplayReader returns a reader of the documents recorded for the feed in dir, in order, one per fetch
+func NewReplayReader(dir string, feed Feed) (FeedReader, error) {
+	recordings, err := listRecordings(dir, []Feed{feed})
+	if err != nil {
+		return nil, err
+	}
+	return newRssReader(feed.Url, feed, newReplayer(recordings).fetch), nil
+}
+
+// replayAndShutdown processes the documents recorded in options.Replay in the order they were fetched,
+// like when running, and shuts down.
+// The repository starts empty, and is not saved, so that replays are the same each time.
+func replayAndShutdown(config *Config, options RunOptions) error {
+	if options.Once || options.Record != "" {
+		return errors.New("replay: cannot be combined with once or record")
+	}
+	if config.Repository.File != "" {
+		log.Printf("replay: ignoring repository file: %s", config.Repository.File)
+		replayConfig := *config
+		replayConfig.Repository.File = ""
+		config = &replayConfig
+	}
+
+	recordings, err := listRecordings(options.Replay, config.Feeds)
+	if err != nil {
+		return err
+	}
+	xpdContext, err := newContext(config, newReplayer(recordings).fetch)
+	if err != nil {
+		return err
+	}
+	if options.Backfill {
+		backfillReaders(xpdContext)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	runErr := replay(ctx, xpdContext, recordings)
+	stop()
+
+	return shutdownAfterRun(xpdContext, runErr)
+}
+
+// replay fetches the feed of each recording in order, and processes the new posts of each fetch.
+// Fetches that fail are logged, like when running.
+func replay(ctx context.Context, context *Context, recordings []recording) error {
+	readers := make(map[string]FeedReader)
+	for _, reader := range context.Readers {
+		readers[reader.GetFeed().Id] = reader
+	}
+
+	count := 0
+	for _, recording := range recordings {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		posts, err := readers[recording.feedId].FetchNewPosts(ctx)
+		if err != nil {
+			log.Printf("error: %s: %s", recording.path, err)
+			continue
+		}
+		for _, post := range posts {
+			processNewPost(ctx, context, post)
+			count++
+		}
+	}
+	log.Printf("replayed %d recording(s), processed %d new post(s)", len(recordings), count)
+	return nil
+}
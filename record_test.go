@@ -0,0 +1,126 @@
+package xpd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// returns a post per fetch, with the content fetched as body
+type fetchingReader struct {
+	feed  Feed
+	fetch fetchFunc
+}
+
+func (reader *fetchingReader) GetFeed() Feed {
+	return reader.feed
+}
+
+func (reader *fetchingReader) FetchNewPosts(ctx context.Context) ([]Post, error) {
+	content, err := reader.fetch(ctx, reader.feed, reader.feed.Url)
+	if err != nil {
+		return nil, err
+	}
+	return []Post{{Id: reader.feed.Id + "/" + string(content), Body: string(content), Feed: &reader.feed}}, nil
+}
+
+func Test_recordFetches_saves_documents_by_feed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fetch := recordFetches(dir, func(ctx context.Context, feed Feed, uri string) ([]byte, error) {
+		return []byte(uri), nil
+	})
+	feed := Feed{Id: "so/en"}
+	for _, uri := range []string{"first", "second"} {
+		if content, err := fetch(context.Background(), feed, uri); err != nil || string(content) != uri {
+			t.Fatalf("got %q, %v; expected the content fetched", content, err)
+		}
+	}
+
+	recordings, err := listRecordings(dir, []Feed{feed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recordings) != 2 || filepath.Dir(recordings[0].path) != filepath.Join(dir, "so%2Fen") {
+		t.Fatalf("got %#v; expected 2 recordings in the directory of the feed", recordings)
+	}
+
+	replayer := newReplayer(recordings)
+	for _, expected := range []string{"first", "second"} {
+		if content, err := replayer.fetch(context.Background(), feed, ""); err != nil || string(content) != expected {
+			t.Fatalf("got %q, %v; expected %q", content, err, expected)
+		}
+	}
+	if _, err := replayer.fetch(context.Background(), feed, ""); err == nil {
+		t.Fatal("got success; expected no more recordings")
+	}
+}
+
+func Test_listRecordings_fails_without_recordings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := listRecordings(dir, []Feed{{Id: "so"}}); err == nil {
+		t.Fatal("got success; expected an error for no recordings")
+	}
+}
+
+func Test_replay_processes_recordings_in_order_of_time(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	saveRecording(dir, "a", now, []byte("hello"))
+	saveRecording(dir, "b", now.Add(-time.Minute), []byte("hello"))
+	saveRecording(dir, "a", now.Add(time.Minute), []byte("bye"))
+
+	feeds := []Feed{{Id: "a"}, {Id: "b"}}
+	recordings, err := listRecordings(dir, feeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer := newReplayer(recordings)
+	events := NewEventStore()
+	repo := NewPostRepository()
+	ctx := context.Background()
+	context := &Context{
+		Readers: []FeedReader{
+			&fetchingReader{feed: feeds[0], fetch: replayer.fetch},
+			&fetchingReader{feed: feeds[1], fetch: replayer.fetch},
+		},
+		Detectors:      []Detector{SameBodyDetector{}},
+		Listeners:      []Listener{events},
+		PostRepository: repo,
+	}
+
+	if err := replay(ctx, context, recordings); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repo.FindRecent()) != 3 {
+		t.Fatalf("got %#v; expected the posts of the 3 recordings", repo.FindRecent())
+	}
+	recent := events.FindRecent()
+	if len(recent) != 1 || recent[0].Post.Feed.Id != "a" || recent[0].Kind != CrossPostEvent {
+		t.Fatalf("got %#v; expected the post of feed a, recorded later, reported as cross-post", recent)
+	}
+}
+
+func Test_replayAndShutdown_rejects_once(t *testing.T) {
+	if err := replayAndShutdown(&Config{Feeds: []Feed{{Id: "a", Url: "http://localhost/a"}}, Detectors: []TypeConfig{{Type: "SameBodyDetector"}}}, RunOptions{Once: true, Replay: "recordings"}); err == nil {
+		t.Fatal("got success; expected replay with once to fail")
+	}
+}
@@ -0,0 +1,216 @@
+package xpd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// how often to check if the configuration file changed; shortened by some tests
+var configPollInterval = 5 * time.Second
+
+// watchConfig sends the configuration to reloads when the file changes, or on SIGHUP.
+// Invalid configurations are logged and skipped.
+func watchConfig(ctx context.Context, path string, reloads chan<- *Config) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	modTime := configModTime(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			log.Println("reloading configuration on SIGHUP:", path)
+		case <-ticker.C:
+			t := configModTime(path)
+			if t.Equal(modTime) {
+				continue
+			}
+			modTime = t
+			log.Println("reloading changed configuration:", path)
+		}
+
+		config, err := ParseConfig(path)
+		if err != nil {
+			log.Printf("error: rejecting new configuration, keeping the current one: %s", err)
+			continue
+		}
+		select {
+		case reloads <- config:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func configModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// components returns the current detectors and listeners, which change on reload
+func (xpdContext *Context) components() ([]Detector, []Listener) {
+	xpdContext.mutex.RLock()
+	defer xpdContext.mutex.RUnlock()
+	return xpdContext.Detectors, xpdContext.Listeners
+}
+
+// readerKey is what the reader of a feed depends on: readers are replaced when it changes on reload,
+// but not when only the ignorePatterns of the feed change
+type readerKey struct {
+	id  string
+	url string
+}
+
+func newReaderKey(feed Feed) readerKey {
+	return readerKey{id: feed.Id, url: feed.Url}
+}
+
+// reload applies a new configuration, keeping the posts, events and statuses of feeds.
+// The readers of unchanged feeds keep running, as they remember the posts already seen.
+// Detectors and listeners are rebuilt, the old listeners delivering their pending events in the background.
+// If the configuration is invalid, nothing changes.
+func (xpdContext *Context) reload(config *Config, pool *readerPool) error {
+	if err := checkConfig(config); err != nil {
+		return err
+	}
+	uris := make(map[string]string)
+	for _, feed := range config.Feeds {
+		uri, err := interpolate(feed.Url)
+		if err != nil {
+			return fmt.Errorf("feed %s: %s", feed.Id, err)
+		}
+		uris[feed.Id] = uri
+	}
+	detectors, err := parseDetectors(config.Detectors)
+	if err != nil {
+		return err
+	}
+	extraListeners, err := parseListeners(config.Listeners, config.Dispatch, xpdContext.Metrics)
+	if err != nil {
+		return err
+	}
+	if xpdContext.boilerplate == nil {
+		xpdContext.boilerplate, err = newBoilerplate(config.Boilerplate, config.Feeds)
+	} else {
+		err = xpdContext.boilerplate.configure(config.Boilerplate, config.Feeds)
+	}
+	if err != nil {
+		// stop the queues and digests of the new listeners, never used
+		shutdownListeners(context.Background(), extraListeners)
+		return err
+	}
+
+	if previous := xpdContext.config; previous != nil && previous.HTTP != config.HTTP {
+		log.Println("warning: changes of the http configuration apply only after restart")
+	}
+	if previous := xpdContext.config; previous != nil && previous.Suppressions != config.Suppressions {
+		log.Println("warning: changes of the suppressions configuration apply only after restart")
+	}
+
+	unchanged := make(map[readerKey]bool)
+	for _, feed := range config.Feeds {
+		unchanged[newReaderKey(feed)] = true
+	}
+
+	var readers []FeedReader
+	for _, reader := range xpdContext.Readers {
+		feed := reader.GetFeed()
+		if unchanged[newReaderKey(feed)] {
+			readers = append(readers, reader)
+			delete(unchanged, newReaderKey(feed))
+			continue
+		}
+		log.Println("removing feed:", feed.Id, feed.Url)
+		pool.stop(reader)
+		xpdContext.Monitor.remove(feed)
+	}
+	for _, feed := range config.Feeds {
+		if !unchanged[newReaderKey(feed)] {
+			continue
+		}
+		delete(unchanged, newReaderKey(feed))
+		log.Println("adding feed:", feed.Id, feed.Url)
+		var reader FeedReader = newMonitoredReader(newRssReader(uris[feed.Id], feed, xpdContext.fetch), xpdContext.Monitor, xpdContext.Metrics)
+		if xpdContext.backfill {
+			reader = &backfillReader{FeedReader: reader, repo: xpdContext.PostRepository}
+		}
+		readers = append(readers, reader)
+		pool.start(reader)
+	}
+
+	listeners := append([]Listener{ConsolePrinterListener{}, xpdContext.Events}, extraListeners...)
+
+	xpdContext.mutex.Lock()
+	previousListeners := xpdContext.Listeners
+	xpdContext.Readers = readers
+	xpdContext.Detectors = detectors
+	xpdContext.Listeners = listeners
+	xpdContext.mutex.Unlock()
+
+	xpdContext.RepositoryFile = config.Repository.File
+	xpdContext.config = config
+	if repo, ok := xpdContext.PostRepository.(retainingRepository); ok {
+		repo.configure(config.Repository)
+		repo.compact(time.Now())
+	}
+
+	xpdContext.draining.Add(1)
+	go func() {
+		defer xpdContext.draining.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), config.shutdownTimeout())
+		defer cancel()
+		shutdownListeners(ctx, previousListeners)
+	}()
+
+	log.Printf("applied new configuration: %d feed(s), %d detector(s), %d listener(s)", len(readers), len(detectors), len(extraListeners))
+	return nil
+}
+
+// readerPool runs a goroutine per reader, sending the new posts it fetches to posts
+type readerPool struct {
+	ctx     context.Context
+	posts   chan<- Post
+	count   int
+	cancels map[FeedReader]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newReaderPool(ctx context.Context, posts chan<- Post, count int) *readerPool {
+	return &readerPool{ctx: ctx, posts: posts, count: count, cancels: make(map[FeedReader]context.CancelFunc)}
+}
+
+func (pool *readerPool) start(reader FeedReader) {
+	ctx, cancel := context.WithCancel(pool.ctx)
+	pool.cancels[reader] = cancel
+	pool.wg.Add(1)
+	go func() {
+		defer pool.wg.Done()
+		waitForPosts(ctx, reader, pool.posts, pool.count)
+	}()
+}
+
+func (pool *readerPool) stop(reader FeedReader) {
+	if cancel, ok := pool.cancels[reader]; ok {
+		cancel()
+		delete(pool.cancels, reader)
+	}
+}
+
+// wait waits for the readers to stop, after the context of the pool is cancelled
+func (pool *readerPool) wait() {
+	pool.wg.Wait()
+}
@@ -0,0 +1,186 @@
+package xpd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// a pool of readers that stop right away, without fetching
+func newStoppedReaderPool() *readerPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return newReaderPool(ctx, make(chan Post), 1)
+}
+
+func Test_Context_reload_keeps_unchanged_feeds_and_posts(t *testing.T) {
+	context, err := ParseContext(&Config{Feeds: []Feed{{Id: "a", Url: "http://localhost/a"}, {Id: "b", Url: "http://localhost/b"}}, Detectors: []TypeConfig{{Type: "SameBodyDetector"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := Post{Id: "1", Feed: &Feed{Id: "a"}}
+	context.PostRepository.Add(post)
+	kept := context.Readers[1]
+
+	config := &Config{Feeds: []Feed{{Id: "b", Url: "http://localhost/b"}, {Id: "c", Url: "http://localhost/c"}}, Detectors: []TypeConfig{{Type: "SimilarWordCountDetector"}}}
+	if err := context.reload(config, newStoppedReaderPool()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(context.Readers) != 2 || context.Readers[0] != kept || context.Readers[1].GetFeed().Id != "c" {
+		t.Fatalf("got %v; expected the reader of b kept, and a new reader of c", context.Readers)
+	}
+	if statuses := context.Monitor.Statuses(); len(statuses) != 2 || statuses[0].Feed.Id != "b" || statuses[1].Feed.Id != "c" {
+		t.Fatalf("got %#v; expected statuses of b and c", statuses)
+	}
+	if name := detectorName(context.Detectors[0]); name != "SimilarWordCountDetector" {
+		t.Fatalf("got %s; expected the new detector", name)
+	}
+	if recent := context.PostRepository.FindRecent(); len(recent) != 1 || recent[0].Id != "1" {
+		t.Fatalf("got %#v; expected the posts kept", recent)
+	}
+}
+
+func Test_Context_reload_backfills_new_feeds(t *testing.T) {
+	context, err := ParseContext(&Config{Feeds: []Feed{{Id: "a", Url: "http://localhost/a"}}, Detectors: []TypeConfig{{Type: "SameBodyDetector"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backfillReaders(context)
+
+	if err := context.reload(&Config{Feeds: []Feed{{Id: "a", Url: "http://localhost/a"}, {Id: "b", Url: "http://localhost/b"}}, Detectors: []TypeConfig{{Type: "SameBodyDetector"}}}, newStoppedReaderPool()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := context.Readers[1].(*backfillReader); !ok || context.Readers[1].GetFeed().Id != "b" {
+		t.Fatalf("got %v; expected the reader of the new feed backfilled", context.Readers)
+	}
+}
+
+func Test_Context_reload_rejects_invalid_config(t *testing.T) {
+	context, err := ParseContext(&Config{Feeds: []Feed{{Id: "a", Url: "http://localhost/a"}}, Detectors: []TypeConfig{{Type: "SameBodyDetector"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readers, detectors := context.Readers, context.Detectors
+
+	invalid := []*Config{
+		{Detectors: []TypeConfig{{Type: "SameBodyDetector"}}},
+		{Feeds: []Feed{{Id: "b"}}, Detectors: []TypeConfig{{Type: "nonexistent"}}},
+		{Feeds: []Feed{{Id: "b"}}, Detectors: []TypeConfig{{Type: "SameBodyDetector"}}, Listeners: []ListenerConfig{{TypeConfig: TypeConfig{Type: "nonexistent"}}}},
+	}
+	for _, config := range invalid {
+		if err := context.reload(config, newStoppedReaderPool()); err == nil {
+			t.Errorf("got success; expected invalid config to be rejected: %#v", config)
+		}
+	}
+
+	if len(context.Readers) != 1 || context.Readers[0] != readers[0] || context.Detectors[0] != detectors[0] {
+		t.Fatal("got context changed; expected it unchanged after invalid configs")
+	}
+}
+
+func Test_Context_reload_delivers_pending_events_of_old_listeners(t *testing.T) {
+	ctx := context.Background()
+	context, err := ParseContext(&Config{Feeds: []Feed{{Id: "a", Url: "http://localhost/a"}}, Detectors: []TypeConfig{{Type: "SameBodyDetector"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := &flakyListener{}
+	queue := NewQueuedListener(listener, DispatchConfig{})
+	context.Listeners = append(context.Listeners, queue)
+
+	post := Post{Id: "1", Feed: &Feed{Id: "dummy"}}
+	queue.OnCrossPost(ctx, post, []Post{post})
+
+	if err := context.reload(&Config{Feeds: []Feed{{Id: "a", Url: "http://localhost/a"}}, Detectors: []TypeConfig{{Type: "SameBodyDetector"}}}, newStoppedReaderPool()); err != nil {
+		t.Fatal(err)
+	}
+	context.draining.Wait()
+
+	if listener.delivered != 1 {
+		t.Fatalf("got %d deliveries; expected the pending event delivered", listener.delivered)
+	}
+	if err := queue.OnCrossPost(ctx, post, []Post{post}); err == nil {
+		t.Fatal("got success; expected the old queue closed")
+	}
+}
+
+func Test_watchConfig_sends_valid_changes(t *testing.T) {
+	configPollInterval = 10 * time.Millisecond
+	defer func() { configPollInterval = 5 * time.Second }()
+
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "xpd.yml")
+	if err := ioutil.WriteFile(path, []byte("feeds: [{id: a, url: 'http://localhost/a'}]\ndetectors: [{type: SameBodyDetector}]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloads := make(chan *Config)
+	go watchConfig(ctx, path, reloads)
+
+	modTime := time.Now()
+	write := func(content string) {
+		// distinct modification times, regardless of the resolution of the file system
+		modTime = modTime.Add(time.Minute)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("feeds: [")
+	select {
+	case config := <-reloads:
+		t.Fatalf("got %#v; expected malformed config skipped", config)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	write("feeds: [{id: b}]\ndetectors: [{type: SameBodyDetector}]")
+	select {
+	case config := <-reloads:
+		t.Fatalf("got %#v; expected invalid config skipped", config)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	write("feeds: [{id: b, url: 'http://localhost/b'}]\ndetectors: [{type: SameBodyDetector}]")
+	select {
+	case config := <-reloads:
+		if len(config.Feeds) != 1 || config.Feeds[0].Id != "b" {
+			t.Fatalf("got %#v; expected the changed config", config)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("got no reload; expected the changed config")
+	}
+}
+
+func Test_Context_reload_keeps_reader_when_only_ignorePatterns_change(t *testing.T) {
+	context, err := ParseContext(&Config{Feeds: []Feed{{Id: "a", Url: "http://localhost/a"}}, Detectors: []TypeConfig{{Type: "SameBodyDetector"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := context.Readers[0]
+
+	config := &Config{Feeds: []Feed{{Id: "a", Url: "http://localhost/a", IgnorePatterns: []string{"^footer$"}}}, Detectors: []TypeConfig{{Type: "SameBodyDetector"}}}
+	if err := context.reload(config, newStoppedReaderPool()); err != nil {
+		t.Fatal(err)
+	}
+	if context.Readers[0] != kept {
+		t.Fatalf("got %v; expected the reader kept", context.Readers)
+	}
+
+	post := context.boilerplate.strip(Post{Body: "hello\nfooter", Feed: &config.Feeds[0]})
+	if post.Body != "hello\n" {
+		t.Fatalf("got %q; expected the new pattern applied", post.Body)
+	}
+}
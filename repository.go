@@ -0,0 +1,262 @@
+package xpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+const defaultCompactInterval = time.Hour
+
+// the reasons of evictions of posts from the repository, in metrics
+const (
+	evictedByAge   = "age"
+	evictedByCount = "count"
+	evictedByQuota = "quota"
+)
+
+// RepositoryConfig configures the persistence and the retention of the recent posts
+type RepositoryConfig struct {
+	// the recent posts are loaded from File on start, and saved to it on shutdown
+	File string
+	// posts published longer ago are evicted; never if 0
+	MaxAge time.Duration `yaml:"maxAge"`
+	// maximum number of posts of all feeds, the oldest being evicted first, default 10000
+	MaxPosts int `yaml:"maxPosts"`
+	// maximum number of posts of each feed, so that chatty feeds do not evict the posts of quiet feeds; none if 0
+	MaxPostsPerFeed int `yaml:"maxPostsPerFeed"`
+	// time between evictions of the posts older than MaxAge, default 1h
+	CompactInterval time.Duration `yaml:"compactInterval"`
+}
+
+func (config RepositoryConfig) maxPosts() int {
+	if config.MaxPosts <= 0 {
+		return defaultPostRepositoryCapacity
+	}
+	return config.MaxPosts
+}
+
+func (config RepositoryConfig) compactInterval() time.Duration {
+	if config.CompactInterval <= 0 {
+		return defaultCompactInterval
+	}
+	return config.CompactInterval
+}
+
+// retainingRepository is implemented by repositories with retention policies,
+// reconfigured on reload, and applied on compactions besides when posts are added
+type retainingRepository interface {
+	configure(RepositoryConfig)
+	compact(now time.Time)
+}
+
+// indexingDetector is implemented by detectors keeping data about posts,
+// pruned of the posts no longer in the repository on compactions
+type indexingDetector interface {
+	pruneIndex(posts []Post)
+}
+
+// newPostRepository returns a repository with the retention policies of the configuration,
+// counting evictions in metrics if not nil
+func newPostRepository(config RepositoryConfig, metrics *Metrics) *defaultPostRepository {
+	repo := &defaultPostRepository{metrics: metrics}
+	repo.configure(config)
+	return repo
+}
+
+// configure replaces the retention policies, applied to the posts already in the repository on the next compaction
+func (repo *defaultPostRepository) configure(config RepositoryConfig) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.capacity = config.maxPosts()
+	repo.feedQuota = config.MaxPostsPerFeed
+	repo.maxAge = config.MaxAge
+}
+
+// compact evicts the posts published before now minus the maximum age,
+// and the oldest posts exceeding the maximum numbers of posts, after a change of configuration
+func (repo *defaultPostRepository) compact(now time.Time) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	evicted := 0
+	if repo.maxAge > 0 {
+		cutoff := now.Add(-repo.maxAge)
+		evicted += repo.evictWhere(evictedByAge, -1, func(post Post) bool {
+			return post.Time.Before(cutoff)
+		})
+	}
+	if repo.feedQuota > 0 {
+		for feedId, seqs := range repo.feeds {
+			if len(seqs) <= repo.feedQuota {
+				continue
+			}
+			evicted += repo.evictWhere(evictedByQuota, len(seqs)-repo.feedQuota, func(post Post) bool {
+				return post.feedId() == feedId
+			})
+		}
+	}
+	if excess := len(repo.posts) - repo.capacity; excess > 0 {
+		evicted += repo.evictWhere(evictedByCount, excess, func(Post) bool {
+			return true
+		})
+	}
+	if evicted > 0 {
+		log.Printf("evicted %d post(s) from the repository, keeping %d", evicted, len(repo.posts))
+	}
+}
+
+// evictWhere evicts the first limit posts matching, or all of them if limit is negative, returning how many.
+// The posts are copied, as FindRecent returns them to readers without the lock.
+func (repo *defaultPostRepository) evictWhere(reason string, limit int, matches func(Post) bool) int {
+	posts := make([]Post, 0, len(repo.posts))
+	seqs := make([]int, 0, len(repo.seqs))
+	evicted := 0
+	for i, post := range repo.posts {
+		if evicted != limit && matches(post) {
+			repo.forget(post, reason)
+			evicted++
+			continue
+		}
+		posts = append(posts, post)
+		seqs = append(seqs, repo.seqs[i])
+	}
+	if evicted == 0 {
+		return 0
+	}
+	repo.posts = posts
+	repo.seqs = seqs
+	return evicted
+}
+
+// evictAt evicts the post at the position, copying the posts like evictWhere
+func (repo *defaultPostRepository) evictAt(position int, reason string) {
+	repo.forget(repo.posts[position], reason)
+	posts := make([]Post, 0, len(repo.posts)-1)
+	repo.posts = append(append(posts, repo.posts[:position]...), repo.posts[position+1:]...)
+	repo.seqs = append(repo.seqs[:position], repo.seqs[position+1:]...)
+}
+
+// forget removes the post from the index and from the posts of its feed, counting its eviction
+func (repo *defaultPostRepository) forget(post Post, reason string) {
+	feedId := post.feedId()
+	key := postKey(post)
+	seqs := repo.feeds[feedId]
+	if i := sort.SearchInts(seqs, repo.index[key]); i == 0 {
+		seqs = seqs[1:]
+	} else {
+		seqs = append(seqs[:i], seqs[i+1:]...)
+	}
+	if len(seqs) == 0 {
+		delete(repo.feeds, feedId)
+	} else {
+		repo.feeds[feedId] = seqs
+	}
+	delete(repo.index, key)
+	repo.metrics.Add("xpd_repository_evictions_total", 1, feedId, reason)
+}
+
+func (xpdContext *Context) compactInterval() time.Duration {
+	if xpdContext.config == nil {
+		return defaultCompactInterval
+	}
+	return xpdContext.config.Repository.compactInterval()
+}
+
+// compactRepository applies the retention policies of the repository, if any,
+// and prunes the indexes of the detectors of the posts no longer in it
+func compactRepository(xpdContext *Context, now time.Time) {
+	if repo, ok := xpdContext.PostRepository.(retainingRepository); ok {
+		repo.compact(now)
+	}
+	detectors, _ := xpdContext.components()
+	posts := xpdContext.PostRepository.FindRecent()
+	for _, detector := range detectors {
+		if indexing, ok := detector.(indexingDetector); ok {
+			indexing.pruneIndex(posts)
+		}
+	}
+}
+
+type savedPost struct {
+	PostRecord
+	Body   string `json:"body"`
+	Thread string `json:"thread,omitempty"`
+	Parent string `json:"parent,omitempty"`
+	// the body compared by the detectors, as the boilerplate learned is not saved
+	Stripped string `json:"stripped,omitempty"`
+}
+
+func (saved savedPost) toPost(feed *Feed) Post {
+	return Post{
+		Id:       saved.Id,
+		Url:      saved.Url,
+		Author:   saved.Author,
+		Subject:  saved.Subject,
+		Body:     saved.Body,
+		Time:     saved.Time,
+		Feed:     feed,
+		Thread:   saved.Thread,
+		Parent:   saved.Parent,
+		stripped: saved.Stripped,
+	}
+}
+
+// loadPosts adds the posts saved in the file to the repository, if the file exists
+func loadPosts(repo PostRepository, path string, feeds []Feed) error {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("repository: %s", err)
+	}
+
+	var saved []savedPost
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return fmt.Errorf("repository: %s: %s", path, err)
+	}
+
+	feedsById := make(map[string]*Feed)
+	for i := range feeds {
+		feedsById[feeds[i].Id] = &feeds[i]
+	}
+
+	for _, post := range saved {
+		feed, ok := feedsById[post.Feed]
+		if !ok {
+			feed = &Feed{Id: post.Feed}
+			feedsById[post.Feed] = feed
+		}
+		repo.Add(post.toPost(feed))
+	}
+	log.Printf("loaded %d post(s) from %s", len(saved), path)
+	return nil
+}
+
+// savePosts writes the posts of the repository to the file, replacing it atomically
+func savePosts(repo PostRepository, path string) error {
+	posts := repo.FindRecent()
+	saved := make([]savedPost, len(posts))
+	for i, post := range posts {
+		saved[i] = savedPost{PostRecord: newPostRecord(post), Body: post.Body, Thread: post.Thread, Parent: post.Parent, Stripped: post.stripped}
+	}
+
+	content, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("repository: %s", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("repository: %s", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("repository: %s", err)
+	}
+	log.Printf("saved %d post(s) to %s", len(saved), path)
+	return nil
+}
@@ -0,0 +1,121 @@
+package xpd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_savePosts_and_loadPosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "posts.json")
+
+	so := Feed{Id: "so", Url: "http://so"}
+	published := time.Date(2016, 3, 1, 10, 30, 0, 0, time.UTC)
+	repo := NewPostRepository()
+	repo.Add(Post{Id: "1", Url: "http://so/1", Author: "jack", Subject: "hello", Body: "<p>hello</p>", Time: published, Feed: &so})
+	repo.Add(Post{Id: "2", Feed: &Feed{Id: "removed"}})
+
+	if err := savePosts(repo, path); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := []Feed{so}
+	loaded := NewPostRepository()
+	if err := loadPosts(loaded, path, feeds); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := loaded.FindRecent()
+	if len(posts) != 2 {
+		t.Fatalf("got %d posts; expected 2", len(posts))
+	}
+	post := posts[0]
+	if post.Id != "1" || post.Body != "<p>hello</p>" || !post.Time.Equal(published) || post.Feed != &feeds[0] {
+		t.Fatalf("got %#v; expected the saved post, of the configured feed", post)
+	}
+	if posts[1].Feed.Id != "removed" {
+		t.Fatalf("got %#v; expected the post of an unknown feed kept", posts[1])
+	}
+}
+
+func Test_loadPosts_ignores_missing_file(t *testing.T) {
+	if err := loadPosts(NewPostRepository(), "nonexistent.json", nil); err != nil {
+		t.Fatalf("got error: %s; expected nothing loaded", err)
+	}
+}
+
+func Test_loadPosts_fails_on_malformed_file(t *testing.T) {
+	file, err := ioutil.TempFile("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("not json")
+	file.Close()
+
+	if err := loadPosts(NewPostRepository(), file.Name(), nil); err == nil {
+		t.Fatal("got success; expected malformed file to fail")
+	}
+}
+
+func Test_defaultPostRepository_feed_quota(t *testing.T) {
+	metrics := NewMetrics()
+	repo := newPostRepository(RepositoryConfig{MaxPosts: 4, MaxPostsPerFeed: 2}, metrics)
+	so, gg := &Feed{Id: "so"}, &Feed{Id: "gg"}
+	repo.Add(Post{Id: "1", Feed: gg})
+	for _, id := range []string{"2", "3", "4", "5"} {
+		repo.Add(Post{Id: id, Feed: so})
+	}
+
+	if recent := repo.FindRecent(); len(recent) != 3 || recent[0].Id != "1" || recent[1].Id != "4" {
+		t.Fatalf("got %#v; expected the post of the quiet feed kept", recent)
+	}
+	for _, key := range [][]string{{"gg", "1"}, {"so", "4"}, {"so", "5"}} {
+		if post, ok := repo.Get(key[0], key[1]); !ok || post.Id != key[1] {
+			t.Fatalf("got %#v; expected the post %s found after evictions", post, key)
+		}
+	}
+	if _, ok := repo.Get("so", "2"); ok {
+		t.Fatal("got the evicted post; expected it forgotten")
+	}
+	if evicted := metrics.Get("xpd_repository_evictions_total", "so", evictedByQuota); evicted != 2 {
+		t.Fatalf("got %g evictions; expected 2", evicted)
+	}
+}
+
+func Test_defaultPostRepository_compact(t *testing.T) {
+	metrics := NewMetrics()
+	repo := newPostRepository(RepositoryConfig{MaxAge: 24 * time.Hour}, metrics)
+	so := &Feed{Id: "so"}
+	now := time.Date(2016, 3, 1, 10, 30, 0, 0, time.UTC)
+	repo.Add(Post{Id: "1", Time: now.Add(-48 * time.Hour), Feed: so})
+	repo.Add(Post{Id: "2", Time: now.Add(-time.Hour), Feed: so})
+	repo.Add(Post{Id: "3", Time: now.Add(-72 * time.Hour), Feed: so})
+	repo.Add(Post{Id: "4", Time: now, Feed: so})
+
+	repo.compact(now)
+	if recent := repo.FindRecent(); len(recent) != 2 || recent[0].Id != "2" || recent[1].Id != "4" {
+		t.Fatalf("got %#v; expected the old posts evicted", recent)
+	}
+	if evicted := metrics.Get("xpd_repository_evictions_total", "so", evictedByAge); evicted != 2 {
+		t.Fatalf("got %g evictions; expected 2", evicted)
+	}
+
+	// a smaller maximum applies on the next compaction
+	repo.configure(RepositoryConfig{MaxPosts: 1})
+	repo.compact(now)
+	if recent := repo.FindRecent(); len(recent) != 1 || recent[0].Id != "4" {
+		t.Fatalf("got %#v; expected the oldest post evicted", recent)
+	}
+	repo.Add(Post{Id: "5", Feed: so})
+	if post, ok := repo.Get("so", "5"); !ok || post.Id != "5" {
+		t.Fatalf("got %#v; expected the new post found", post)
+	}
+}
@@ -1,20 +1,45 @@
 package xpd
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	rss "github.com/jteeuwen/go-pkg-rss"
+	"github.com/xpd-org/xpd/secret"
 	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
 type rssReader struct {
-	uri      string
+	// the URL to fetch, with interpolated secrets, unlike feed.Url
+	uri      secret.Value
 	feed     Feed
+	fetch    fetchFunc
 	rssFeed  *rss.Feed
 	newPosts []Post
+	// the content hashes of the items of the feed, by post id, to find the edited items
+	hashes map[string]string
 }
 
+// fetchFunc gets the content of a feed from uri, its interpolated Url
+type fetchFunc func(ctx context.Context, feed Feed, uri string) ([]byte, error)
+
 func NewRssReader(uri string, feed Feed) FeedReader {
-	reader := rssReader{uri: uri, feed: feed}
+	return newRssReader(uri, feed, fetchFeed)
+}
+
+func newRssReader(uri string, feed Feed, fetch fetchFunc) FeedReader {
+	if fetch == nil {
+		fetch = fetchFeed
+	}
+	reader := rssReader{uri: secret.Value(uri), feed: feed, fetch: fetch}
 	timeout := 0
 	reader.rssFeed = rss.New(timeout, true, reader.chanHandler, reader.itemHandler)
 	return &reader
@@ -27,16 +52,7 @@ func (reader *rssReader) chanHandler(feed *rss.Feed, newchannels []*rss.Channel)
 func (reader *rssReader) itemHandler(feed *rss.Feed, ch *rss.Channel, newitems []*rss.Item) {
 	posts := make([]Post, len(newitems))
 	for i, item := range newitems {
-		id := extractPostId(item)
-		post := Post{
-			Id:      id,
-			Url:     id,
-			Author:  item.Author.Name,
-			Subject: item.Title,
-			Body:    item.Description,
-			Feed:    &reader.feed,
-		}
-		posts[i] = post
+		posts[i] = reader.newPost(item)
 	}
 
 	reader.newPosts = posts
@@ -48,20 +64,114 @@ func (reader *rssReader) itemHandler(feed *rss.Feed, ch *rss.Channel, newitems [
 	}
 }
 
+func (reader *rssReader) newPost(item *rss.Item) Post {
+	id := extractPostId(item)
+	urls := []string{id}
+	for _, link := range item.Links {
+		urls = append(urls, link.Href)
+	}
+	thread, parent := extractThread(urls, item.Comments, item.Title)
+	return Post{
+		Id:      id,
+		Url:     id,
+		Author:  item.Author.Name,
+		Subject: item.Title,
+		Body:    item.Description,
+		Time:    parsePubDate(item.PubDate),
+		Feed:    &reader.feed,
+		Thread:  thread,
+		Parent:  parent,
+	}
+}
+
+// trackEdits returns the new posts not seen before, followed by the items seen before with a different content, as edited posts.
+// go-pkg-rss only reports the items it has not seen, by key or by content depending on its version,
+// so the content hashes of all the items of the channels are compared with the previous fetch,
+// the last item of an id being its latest version.
+func (reader *rssReader) trackEdits(newPosts []Post, channels []*rss.Channel) []Post {
+	var posts []Post
+	for _, post := range newPosts {
+		if _, seen := reader.hashes[post.Id]; !seen {
+			posts = append(posts, post)
+		}
+	}
+
+	var ids []string
+	latest := make(map[string]*rss.Item)
+	for _, channel := range channels {
+		for _, item := range channel.Items {
+			id := extractPostId(item)
+			if _, ok := latest[id]; !ok {
+				ids = append(ids, id)
+			}
+			latest[id] = item
+		}
+	}
+
+	hashes := make(map[string]string, len(ids))
+	for _, id := range ids {
+		hash := itemHash(latest[id])
+		if previous, seen := reader.hashes[id]; seen && previous != hash {
+			post := reader.newPost(latest[id])
+			post.Edited = true
+			log.Println("edited item:", summaryOfPost(post))
+			posts = append(posts, post)
+		}
+		hashes[id] = hash
+	}
+	reader.hashes = hashes
+	return posts
+}
+
+// itemHash is the hash of the content of an item compared by the detectors
+func itemHash(item *rss.Item) string {
+	hash := sha1.New()
+	io.WriteString(hash, item.Title)
+	hash.Write([]byte{0})
+	io.WriteString(hash, item.Description)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
 func (reader *rssReader) GetFeed() Feed {
 	return reader.feed
 }
 
-func (reader *rssReader) FetchNewPosts() []Post {
+func (reader *rssReader) FetchNewPosts(ctx context.Context) ([]Post, error) {
 	reader.newPosts = nil
 
+	content, err := reader.fetch(ctx, reader.feed, string(reader.uri))
+	if err != nil {
+		// without the URL fetched, which may contain secrets
+		if urlErr, ok := err.(*url.Error); ok {
+			err = fmt.Errorf("%s: %s", urlErr.Op, urlErr.Err)
+		}
+		return []Post{}, fmt.Errorf("%s: %s", reader.feed.Url, err)
+	}
+
 	// note: itemHandler will get called synchronously when there are new posts
-	if err := reader.rssFeed.Fetch(reader.uri, charsetReader); err != nil {
-		log.Printf("error: %s: %s", reader.uri, err)
-		return []Post{}
+	if err := reader.rssFeed.FetchBytes(string(reader.uri), content, charsetReader); err != nil {
+		return []Post{}, fmt.Errorf("%s: %s", reader.feed.Url, err)
+	}
+
+	return reader.trackEdits(reader.newPosts, reader.rssFeed.Channels), nil
+}
+
+// fetchFeed gets the content of a feed, cancelled with ctx
+func fetchFeed(ctx context.Context, feed Feed, uri string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	return reader.newPosts
+	if resp.StatusCode/100 != 2 {
+		return nil, errors.New(resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
 }
 
 func charsetReader(charset string, r io.Reader) (io.Reader, error) {
@@ -80,3 +190,17 @@ func extractPostId(item *rss.Item) string {
 	}
 	return ""
 }
+
+var pubDateLayouts = []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"}
+
+// parsePubDate parses the publication date of an item in the formats used by RSS and Atom feeds,
+// defaulting to the current time
+func parsePubDate(pubDate string) time.Time {
+	pubDate = strings.TrimSpace(pubDate)
+	for _, layout := range pubDateLayouts {
+		if t, err := time.Parse(layout, pubDate); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
@@ -1,8 +1,10 @@
 package xpd
 
 import (
+	"context"
 	rss "github.com/jteeuwen/go-pkg-rss"
 	"testing"
+	"time"
 )
 
 func newDummyItem() *rss.Item {
@@ -60,8 +62,45 @@ func Test_charsetReader(t *testing.T) {
 }
 
 func Test_FetchNewPosts_should_return_empty_when_no_new(t *testing.T) {
-	posts := NewRssReader("dummy url", Feed{}).FetchNewPosts()
+	posts, _ := NewRssReader("dummy url", Feed{}).FetchNewPosts(context.Background())
 	if len(posts) != 0 {
 		t.Fatalf("got %d posts, expected none", len(posts))
 	}
 }
+
+func Test_parsePubDate(t *testing.T) {
+	expected := time.Date(2016, 3, 1, 10, 30, 0, 0, time.UTC)
+	for _, pubDate := range []string{"Tue, 01 Mar 2016 10:30:00 +0000", "2016-03-01T10:30:00Z", " Tue, 1 Mar 2016 10:30:00 +0000 "} {
+		if actual := parsePubDate(pubDate); !actual.Equal(expected) {
+			t.Errorf("got %s for %#v; expected %s", actual, pubDate, expected)
+		}
+	}
+
+	if actual := parsePubDate("malformed"); time.Since(actual) > time.Minute {
+		t.Errorf("got %s; expected the current time for malformed date", actual)
+	}
+}
+
+func Test_trackEdits(t *testing.T) {
+	reader := NewRssReader("dummy url", Feed{Id: "so"}).(*rssReader)
+	first, second := &rss.Item{Id: "1", Title: "How to?"}, &rss.Item{Id: "2", Title: "Why?"}
+	channels := []*rss.Channel{{Items: []*rss.Item{first, second}}}
+
+	reader.itemHandler(nil, nil, channels[0].Items)
+	if posts := reader.trackEdits(reader.newPosts, channels); len(posts) != 2 || posts[0].Edited {
+		t.Fatalf("got %#v; expected the new posts", posts)
+	}
+
+	// the edit appended as a new item, like go-pkg-rss does for items of a different content
+	edited := &rss.Item{Id: "1", Title: "How to?", Description: "cross-posted at http://so/1"}
+	channels[0].Items = append(channels[0].Items, edited)
+	reader.itemHandler(nil, nil, []*rss.Item{edited})
+	posts := reader.trackEdits(reader.newPosts, channels)
+	if len(posts) != 1 || !posts[0].Edited || posts[0].Id != "1" || posts[0].Body != edited.Description {
+		t.Fatalf("got %#v; expected the edited post only", posts)
+	}
+
+	if posts := reader.trackEdits(nil, channels); len(posts) != 0 {
+		t.Fatalf("got %#v; expected no posts when nothing changed", posts)
+	}
+}
@@ -12,5 +12,6 @@ test $# = 0 && set -- $(names)
 for name; do
     info stopping $name ...
     screen -S $prefix-$name -wipe >/dev/null || :
-    screen -S $prefix-$name -p 0 -X stuff 
+    # xpd shuts down gracefully on SIGTERM, delivering pending events
+    pkill -TERM -f "xpd -config conf/$name.yml" || :
 done
@@ -0,0 +1,28 @@
+// Package secret keeps sensitive configuration values, like passwords and API keys, out of logs
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// what secret values are formatted as
+const redacted = "*"
+
+// Value is a string redacted when formatted with fmt, with any verb, or marshalled to JSON.
+// Convert it to string to use the actual value.
+type Value string
+
+// Format implements fmt.Formatter, so that secrets are redacted with %v, %s, %#v and others,
+// also as fields of structs
+func (value Value) Format(f fmt.State, verb rune) {
+	if verb == 'q' || verb == 'v' && f.Flag('#') {
+		fmt.Fprintf(f, "%q", redacted)
+		return
+	}
+	fmt.Fprint(f, redacted)
+}
+
+func (value Value) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
@@ -0,0 +1,37 @@
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_Value_is_redacted(t *testing.T) {
+	value := Value("hunter2")
+	s := struct {
+		User string
+		Pass Value
+	}{"jack", value}
+
+	for _, format := range []string{"%v", "%s", "%+v", "%#v", "%q", "%x"} {
+		if actual := fmt.Sprintf(format, s); strings.Contains(actual, "hunter2") {
+			t.Errorf("got %s with %s; expected the secret redacted", actual, format)
+		}
+	}
+	if actual := fmt.Sprintf("%#v", s); actual != `struct { User string; Pass secret.Value }{User:"jack", Pass:"*"}` {
+		t.Errorf("got %s; expected the secret redacted", actual)
+	}
+
+	content, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := string(content); actual != `{"User":"jack","Pass":"*"}` {
+		t.Errorf("got %s; expected the secret redacted", actual)
+	}
+
+	if string(value) != "hunter2" {
+		t.Fatalf("got %s; expected the actual value when converted to string", string(value))
+	}
+}
@@ -0,0 +1,89 @@
+package xpd
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/xpd-org/xpd/secret"
+	"log"
+	"net/http"
+	"time"
+)
+
+const defaultDashboardRefresh = time.Minute
+
+// HTTPConfig configures the built-in HTTP server, disabled if Addr is empty
+type HTTPConfig struct {
+	// address to listen on, for example ":8080" or "localhost:8080"
+	Addr string
+	// auto-refresh interval of the dashboard
+	Refresh time.Duration
+	// required as "Bearer {token}" in the Authorization header of the API requests other than GET,
+	// which are refused if not set; interpolated, like "${XPD_HTTP_TOKEN}"
+	Token secret.Value
+}
+
+// NewServeMux creates the HTTP handlers of xpd
+func NewServeMux(context *Context, config HTTPConfig) *http.ServeMux {
+	if config.Refresh <= 0 {
+		config.Refresh = defaultDashboardRefresh
+	}
+
+	mux := http.NewServeMux()
+
+	dashboard := &dashboard{context: context, refresh: config.Refresh}
+	mux.HandleFunc("/", dashboard.index)
+	mux.HandleFunc("/events/", dashboard.event)
+
+	token, err := interpolate(string(config.Token))
+	if err != nil {
+		log.Printf("error: http.token: %s", err)
+	}
+
+	api := &api{context: context}
+	mux.HandleFunc("/api/feeds", api.feeds)
+	mux.HandleFunc("/api/posts", api.posts)
+	mux.HandleFunc("/api/events", api.events)
+	mux.HandleFunc("/api/events/", api.event)
+	mux.HandleFunc("/api/clusters", api.clusters)
+	mux.HandleFunc("/api/match", requireToken(secret.Value(token), api.match))
+	mux.HandleFunc("/api/suppressions", requireToken(secret.Value(token), api.suppressions))
+	mux.HandleFunc("/api/suppressions/", requireToken(secret.Value(token), api.suppression))
+
+	mux.HandleFunc("/metrics", metricsHandler(context))
+
+	return mux
+}
+
+// requireToken refuses the requests other than GET without the token,
+// as they change the suppressions, or run the detectors, and xpd may listen on any network
+func requireToken(token secret.Value, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" || r.Method == "HEAD" {
+			handler(w, r)
+			return
+		}
+		if token == "" {
+			writeError(w, http.StatusForbidden, fmt.Errorf("configure http.token to %s %s", r.Method, r.URL.Path))
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// startHTTP serves HTTP in the background, until the returned server is shut down
+func startHTTP(context *Context, config HTTPConfig) *http.Server {
+	server := &http.Server{Addr: config.Addr, Handler: NewServeMux(context, config)}
+	log.Println("serving HTTP on:", config.Addr)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("error: http: %s", err)
+		}
+	}()
+	return server
+}
@@ -0,0 +1,76 @@
+package xpd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// shutdowner is implemented by listeners with pending work to finish on shutdown
+type shutdowner interface {
+	Shutdown(context.Context) error
+}
+
+// unwrapListener returns the listener wrapped by the given one, or nil
+func unwrapListener(listener Listener) Listener {
+	switch wrapper := listener.(type) {
+	case *FilteredListener:
+		return wrapper.Listener
+	case *DigestListener:
+		return wrapper.Listener
+	case *QueuedListener:
+		return wrapper.Listener
+	}
+	return nil
+}
+
+// Shutdown finishes the pending work of the listeners, and saves the repository.
+// Pending events that could not be delivered before ctx is done are dead-lettered.
+func (xpdContext *Context) Shutdown(ctx context.Context) error {
+	_, listeners := xpdContext.components()
+	errs := shutdownListeners(ctx, listeners)
+	xpdContext.draining.Wait()
+
+	if xpdContext.RepositoryFile != "" {
+		if err := savePosts(xpdContext.PostRepository, xpdContext.RepositoryFile); err != nil {
+			log.Printf("error: shutdown: %s", err)
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("shutdown: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// shutdownListeners shuts down the listeners in parallel, returning the errors.
+// Each chain of listeners is shut down from the outermost wrapper inwards,
+// so that flushed digests are delivered by the queues, before the queued commands are waited for.
+func shutdownListeners(ctx context.Context, listeners []Listener) []string {
+	var mutex sync.Mutex
+	var errs []string
+
+	var wg sync.WaitGroup
+	for _, listener := range listeners {
+		wg.Add(1)
+		go func(listener Listener) {
+			defer wg.Done()
+			for ; listener != nil; listener = unwrapListener(listener) {
+				if s, ok := listener.(shutdowner); ok {
+					if err := s.Shutdown(ctx); err != nil {
+						log.Printf("error: shutdown: %s", err)
+						mutex.Lock()
+						errs = append(errs, err.Error())
+						mutex.Unlock()
+					}
+				}
+			}
+		}(listener)
+	}
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,74 @@
+package xpd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_unwrapListener(t *testing.T) {
+	inner := &mockListener{}
+	queue := NewQueuedListener(inner, DispatchConfig{})
+	defer queue.Close()
+	digest, _ := NewDigestListener(queue, DigestConfig{MaxEvents: 10})
+	filtered := &FilteredListener{Listener: digest, Filter: &EventFilter{}}
+
+	var chain []Listener
+	for listener := Listener(filtered); listener != nil; listener = unwrapListener(listener) {
+		chain = append(chain, listener)
+	}
+	if len(chain) != 4 || chain[1] != digest || chain[2] != queue || chain[3] != inner {
+		t.Fatalf("got %v; expected filter, digest, queue, listener", chain)
+	}
+}
+
+func Test_Context_Shutdown_flushes_digests_and_delivers_queued_events(t *testing.T) {
+	listener := &flakyListener{}
+	queue := NewQueuedListener(listener, DispatchConfig{})
+	digest, err := NewDigestListener(queue, DigestConfig{Every: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := Post{Id: "1", Feed: &Feed{Id: "dummy"}}
+	digest.OnCrossPost(context.Background(), post, []Post{post})
+
+	context := &Context{Listeners: []Listener{ConsolePrinterListener{}, digest}, PostRepository: NewPostRepository()}
+	if err := context.Shutdown(newTimeoutContext(t)); err != nil {
+		t.Fatalf("got error: %s; expected clean shutdown", err)
+	}
+
+	if listener.digests != 1 || listener.delivered != 1 {
+		t.Fatalf("got %d digests, %d deliveries; expected the buffered event delivered", listener.digests, listener.delivered)
+	}
+}
+
+func Test_Context_Shutdown_saves_repository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "posts.json")
+
+	repo := NewPostRepository()
+	repo.Add(Post{Id: "1", Body: "hello", Feed: &Feed{Id: "so"}})
+
+	context := &Context{PostRepository: repo, RepositoryFile: path}
+	if err := context.Shutdown(newTimeoutContext(t)); err != nil {
+		t.Fatalf("got error: %s; expected clean shutdown", err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("got %s; expected repository saved", err)
+	}
+}
+
+func newTimeoutContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
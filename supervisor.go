@@ -0,0 +1,421 @@
+package xpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fetched feeds are shared by the projects for this long
+const sharedFetchMaxAge = time.Minute
+
+// shared fetches are not cancelled with the readers waiting for them, but take at most this long
+const sharedFetchTimeout = time.Minute
+
+// Supervisor runs a project per configuration file of a directory,
+// each with its own feeds, detectors, listeners and repository.
+// Projects are started and stopped as configuration files are added and removed.
+type Supervisor struct {
+	Dir      string
+	fetcher  *sharedFetcher
+	mutex    sync.RWMutex
+	projects map[string]*project
+	// configuration files that failed to load, by modification time, not to retry until changed
+	failed map[string]failedProject
+}
+
+type project struct {
+	name    string
+	path    string
+	context *Context
+	mux     *http.ServeMux
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+type failedProject struct {
+	modTime time.Time
+	err     error
+}
+
+func NewSupervisor(dir string) *Supervisor {
+	return &Supervisor{
+		Dir:      dir,
+		fetcher:  newSharedFetcher(sharedFetchMaxAge, fetchFeed),
+		projects: make(map[string]*project),
+		failed:   make(map[string]failedProject),
+	}
+}
+
+// RunSupervisor runs the projects configured in dir until SIGINT or SIGTERM,
+// serving their combined status on addr if not empty
+func RunSupervisor(dir, addr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	supervisor := NewSupervisor(dir)
+	supervisor.scan(ctx)
+	if len(supervisor.snapshot()) == 0 {
+		return fmt.Errorf("no valid configuration in %s", filepath.Join(dir, "*.yml"))
+	}
+
+	var server *http.Server
+	if addr != "" {
+		server = &http.Server{Addr: addr, Handler: supervisor.ServeMux()}
+		log.Println("serving HTTP on:", addr)
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("error: http: %s", err)
+			}
+		}()
+	}
+
+	supervisor.watch(ctx)
+	// a second signal kills the process, without waiting for the shutdown
+	stop()
+
+	err := supervisor.Shutdown()
+	if server != nil {
+		server.Close()
+	}
+	return err
+}
+
+// watch scans the directory periodically, until ctx is done
+func (supervisor *Supervisor) watch(ctx context.Context) {
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			supervisor.scan(ctx)
+		}
+	}
+}
+
+// scan starts the projects of new configuration files, and stops those of removed files.
+// Changes of existing files are applied by the projects themselves.
+func (supervisor *Supervisor) scan(ctx context.Context) {
+	paths, err := filepath.Glob(filepath.Join(supervisor.Dir, "*.yml"))
+	if err != nil {
+		log.Printf("error: %s", err)
+		return
+	}
+
+	found := make(map[string]string)
+	for _, path := range paths {
+		found[projectName(path)] = path
+	}
+
+	for name, project := range supervisor.snapshot() {
+		if _, ok := found[name]; !ok {
+			log.Println("stopping project of removed configuration:", project.path)
+			supervisor.stop(project)
+		}
+	}
+
+	for name, path := range found {
+		if _, ok := supervisor.snapshot()[name]; ok {
+			continue
+		}
+		modTime := configModTime(path)
+		supervisor.mutex.RLock()
+		failed, ok := supervisor.failed[name]
+		supervisor.mutex.RUnlock()
+		if ok && failed.modTime.Equal(modTime) {
+			continue
+		}
+		if err := supervisor.start(ctx, name, path); err != nil {
+			log.Printf("error: project %s: %s", name, err)
+			supervisor.mutex.Lock()
+			supervisor.failed[name] = failedProject{modTime: modTime, err: err}
+			supervisor.mutex.Unlock()
+		}
+	}
+	// the feeds of removed projects, or removed from projects, are no longer fetched
+	supervisor.fetcher.evictStale()
+
+	supervisor.mutex.Lock()
+	for name := range supervisor.failed {
+		if _, ok := found[name]; !ok {
+			delete(supervisor.failed, name)
+		}
+	}
+	supervisor.mutex.Unlock()
+}
+
+func (supervisor *Supervisor) start(ctx context.Context, name, path string) error {
+	config, err := ParseConfig(path)
+	if err != nil {
+		return err
+	}
+	xpdContext, err := newContext(config, supervisor.fetcher.fetch)
+	if err != nil {
+		return err
+	}
+	if config.HTTP.Addr != "" {
+		log.Printf("warning: project %s: http.addr is ignored, served under /projects/%s/", name, name)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	reloads := make(chan *Config)
+	xpdContext.reloads = reloads
+	go watchConfig(ctx, path, reloads)
+
+	project := &project{
+		name:    name,
+		path:    path,
+		context: xpdContext,
+		mux:     NewServeMux(xpdContext, config.HTTP),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(project.done)
+		run(ctx, xpdContext, defaultCount)
+	}()
+
+	supervisor.mutex.Lock()
+	supervisor.projects[name] = project
+	delete(supervisor.failed, name)
+	supervisor.mutex.Unlock()
+
+	log.Println("started project:", name)
+	return nil
+}
+
+// stop stops fetching the feeds of the project, and shuts it down
+func (supervisor *Supervisor) stop(project *project) error {
+	supervisor.mutex.Lock()
+	delete(supervisor.projects, project.name)
+	supervisor.mutex.Unlock()
+
+	project.cancel()
+	<-project.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), project.context.config.shutdownTimeout())
+	defer cancel()
+	if err := project.context.Shutdown(ctx); err != nil {
+		return fmt.Errorf("%s: %s", project.name, err)
+	}
+	log.Println("stopped project:", project.name)
+	return nil
+}
+
+// Shutdown stops all the projects, in parallel
+func (supervisor *Supervisor) Shutdown() error {
+	var mutex sync.Mutex
+	var errs []string
+
+	var wg sync.WaitGroup
+	for _, p := range supervisor.snapshot() {
+		wg.Add(1)
+		go func(p *project) {
+			defer wg.Done()
+			if err := supervisor.stop(p); err != nil {
+				mutex.Lock()
+				errs = append(errs, err.Error())
+				mutex.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (supervisor *Supervisor) snapshot() map[string]*project {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+	projects := make(map[string]*project, len(supervisor.projects))
+	for name, project := range supervisor.projects {
+		projects[name] = project
+	}
+	return projects
+}
+
+// projectName is the name of the configuration file, without extension
+func projectName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// ProjectStatus is a summary of the state of a project
+type ProjectStatus struct {
+	Name         string `json:"name"`
+	Config       string `json:"config"`
+	Running      bool   `json:"running"`
+	Error        string `json:"error,omitempty"`
+	Feeds        int    `json:"feeds"`
+	HealthyFeeds int    `json:"healthyFeeds"`
+	Posts        int    `json:"posts"`
+	Events       int    `json:"events"`
+}
+
+// Statuses returns the status of the running and failed projects, by name
+func (supervisor *Supervisor) Statuses() []ProjectStatus {
+	var statuses []ProjectStatus
+	for name, project := range supervisor.snapshot() {
+		status := ProjectStatus{Name: name, Config: project.path, Running: true}
+		for _, feed := range project.context.Monitor.Statuses() {
+			status.Feeds++
+			if feed.Healthy() {
+				status.HealthyFeeds++
+			}
+		}
+		status.Posts = len(project.context.PostRepository.FindRecent())
+		status.Events = len(project.context.Events.FindRecent())
+		statuses = append(statuses, status)
+	}
+
+	supervisor.mutex.RLock()
+	for name, failed := range supervisor.failed {
+		statuses = append(statuses, ProjectStatus{Name: name, Config: filepath.Join(supervisor.Dir, name+".yml"), Error: failed.err.Error()})
+	}
+	supervisor.mutex.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+var supervisorIndex = template.Must(template.New("supervisor").Funcs(dashboardFuncs).Parse(dashboardLayout + `
+{{template "header" .}}
+<table>
+<tr><th>Project</th><th>Status</th><th>Healthy feeds</th><th>Stored posts</th><th>Recent events</th></tr>
+{{range .Projects}}
+<tr>
+<td>{{if .Running}}<a href="projects/{{.Name}}/">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td>
+<td>{{if .Running}}<span class="ok">running</span>{{else}}<span class="error">{{.Error}}</span>{{end}}</td>
+<td>{{.HealthyFeeds}} / {{.Feeds}}</td>
+<td>{{.Posts}}</td>
+<td>{{.Events}}</td>
+</tr>
+{{end}}
+</table>
+{{template "footer" .}}
+`))
+
+// ServeMux serves the combined status of the projects, and the dashboard and API
+// of each project under /projects/{name}/
+func (supervisor *Supervisor) ServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		dashboard := &dashboard{refresh: defaultDashboardRefresh}
+		dashboard.render(w, supervisorIndex, map[string]interface{}{
+			"Title":    "Cross-Post Detector projects",
+			"Projects": supervisor.Statuses(),
+		})
+	})
+
+	mux.HandleFunc("/api/projects", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, supervisor.Statuses())
+	})
+
+	mux.HandleFunc("/projects/", func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/projects/")
+		name := strings.SplitN(path, "/", 2)[0]
+		project, ok := supervisor.snapshot()[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if path == name {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		http.StripPrefix("/projects/"+name, project.mux).ServeHTTP(w, r)
+	})
+
+	return mux
+}
+
+// sharedFetcher fetches each feed at most once per maxAge, for the readers of all projects
+type sharedFetcher struct {
+	maxAge   time.Duration
+	timeout  time.Duration
+	upstream fetchFunc
+	mutex    sync.Mutex
+	entries  map[string]*fetchEntry
+}
+
+type fetchEntry struct {
+	// closed when the fetch is complete
+	done    chan struct{}
+	content []byte
+	err     error
+	time    time.Time
+}
+
+func newSharedFetcher(maxAge time.Duration, fetch fetchFunc) *sharedFetcher {
+	return &sharedFetcher{maxAge: maxAge, timeout: sharedFetchTimeout, upstream: fetch, entries: make(map[string]*fetchEntry)}
+}
+
+// fetch returns the content of the feed, fetched by the first of the readers asking for it,
+// in a context of its own, so that the fetch completes for the other readers if the first one is cancelled
+func (fetcher *sharedFetcher) fetch(ctx context.Context, feed Feed, uri string) ([]byte, error) {
+	fetcher.mutex.Lock()
+	entry, ok := fetcher.entries[uri]
+	if !ok || entry.isStale(fetcher.maxAge) {
+		entry = &fetchEntry{done: make(chan struct{})}
+		fetcher.entries[uri] = entry
+		go func() {
+			fetchCtx, cancel := context.WithTimeout(context.Background(), fetcher.timeout)
+			defer cancel()
+			entry.content, entry.err = fetcher.upstream(fetchCtx, feed, uri)
+			entry.time = time.Now()
+			close(entry.done)
+		}()
+	}
+	fetcher.mutex.Unlock()
+
+	select {
+	case <-entry.done:
+		return entry.content, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// evictStale forgets the fetches that would be fetched again, like those of feeds no longer read
+func (fetcher *sharedFetcher) evictStale() {
+	fetcher.mutex.Lock()
+	defer fetcher.mutex.Unlock()
+	for uri, entry := range fetcher.entries {
+		if entry.isStale(fetcher.maxAge) {
+			delete(fetcher.entries, uri)
+		}
+	}
+}
+
+// isStale is true if the fetch is complete, and failed or older than maxAge
+func (entry *fetchEntry) isStale(maxAge time.Duration) bool {
+	select {
+	case <-entry.done:
+		return entry.err != nil || time.Since(entry.time) > maxAge
+	default:
+		return false
+	}
+}
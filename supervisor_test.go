@@ -0,0 +1,216 @@
+package xpd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_sharedFetcher_fetches_once_per_max_age(t *testing.T) {
+	var fetches int32
+	fetcher := newSharedFetcher(time.Minute, func(ctx context.Context, feed Feed, uri string) ([]byte, error) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(10 * time.Millisecond)
+		return []byte(uri), nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if content, err := fetcher.fetch(context.Background(), Feed{}, "a"); err != nil || string(content) != "a" {
+				t.Errorf("got %q, %v; expected the content of a", content, err)
+			}
+		}()
+	}
+	wg.Wait()
+	fetcher.fetch(context.Background(), Feed{}, "b")
+
+	if fetches != 2 {
+		t.Fatalf("got %d fetches; expected 1 per feed", fetches)
+	}
+}
+
+func Test_sharedFetcher_does_not_keep_errors(t *testing.T) {
+	var fetches int32
+	fetcher := newSharedFetcher(time.Minute, func(ctx context.Context, feed Feed, uri string) ([]byte, error) {
+		atomic.AddInt32(&fetches, 1)
+		return nil, errors.New("unavailable")
+	})
+
+	fetcher.fetch(context.Background(), Feed{}, "a")
+	if _, err := fetcher.fetch(context.Background(), Feed{}, "a"); err == nil {
+		t.Fatal("got success; expected the error")
+	}
+	if fetches != 2 {
+		t.Fatalf("got %d fetches; expected failed fetches retried", fetches)
+	}
+}
+
+func Test_sharedFetcher_completes_fetch_of_cancelled_reader(t *testing.T) {
+	release := make(chan struct{})
+	fetcher := newSharedFetcher(time.Minute, func(ctx context.Context, feed Feed, uri string) ([]byte, error) {
+		select {
+		case <-release:
+			return []byte(uri), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error)
+	go func() {
+		_, err := fetcher.fetch(ctx, Feed{}, "a")
+		cancelled <- err
+	}()
+	for started := false; !started; time.Sleep(time.Millisecond) {
+		fetcher.mutex.Lock()
+		_, started = fetcher.entries["a"]
+		fetcher.mutex.Unlock()
+	}
+	cancel()
+	if err := <-cancelled; err != context.Canceled {
+		t.Fatalf("got %v; expected the first reader cancelled", err)
+	}
+
+	close(release)
+	if content, err := fetcher.fetch(context.Background(), Feed{}, "a"); err != nil || string(content) != "a" {
+		t.Fatalf("got %q, %v; expected the fetch completed for the other readers", content, err)
+	}
+}
+
+func Test_sharedFetcher_evictStale(t *testing.T) {
+	fetcher := newSharedFetcher(time.Minute, func(ctx context.Context, feed Feed, uri string) ([]byte, error) {
+		return []byte(uri), nil
+	})
+	fetcher.fetch(context.Background(), Feed{}, "a")
+	fetcher.fetch(context.Background(), Feed{}, "b")
+	fetcher.entries["a"].time = time.Now().Add(-2 * time.Minute)
+
+	fetcher.evictStale()
+	if len(fetcher.entries) != 1 || fetcher.entries["b"] == nil {
+		t.Fatalf("got %v; expected only the recent fetch kept", fetcher.entries)
+	}
+}
+
+func newSupervisorTestDir(t *testing.T, configs map[string]string) string {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range configs {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func newTestSupervisor(dir string) *Supervisor {
+	supervisor := NewSupervisor(dir)
+	supervisor.fetcher = newSharedFetcher(time.Minute, func(ctx context.Context, feed Feed, uri string) ([]byte, error) {
+		return nil, errors.New("offline")
+	})
+	return supervisor
+}
+
+const supervisorTestConfig = `
+feeds:
+  - id: so
+    url: http://localhost/so
+detectors:
+  - type: SameBodyDetector
+`
+
+func Test_Supervisor_scan_starts_and_stops_projects(t *testing.T) {
+	dir := newSupervisorTestDir(t, map[string]string{
+		"a.yml":      supervisorTestConfig,
+		"b.yml":      supervisorTestConfig,
+		"broken.yml": "feeds: []",
+		"notes.txt":  "ignored",
+	})
+	defer os.RemoveAll(dir)
+
+	supervisor := newTestSupervisor(dir)
+	defer supervisor.Shutdown()
+	supervisor.scan(context.Background())
+
+	statuses := supervisor.Statuses()
+	if len(statuses) != 3 || !statuses[0].Running || !statuses[1].Running || statuses[2].Running || statuses[2].Error == "" {
+		t.Fatalf("got %#v; expected a and b running, and the error of broken", statuses)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "a.yml")); err != nil {
+		t.Fatal(err)
+	}
+	supervisor.scan(context.Background())
+
+	if statuses := supervisor.Statuses(); len(statuses) != 2 || statuses[0].Name != "b" {
+		t.Fatalf("got %#v; expected the project of a stopped", statuses)
+	}
+}
+
+func Test_Supervisor_projects_are_isolated(t *testing.T) {
+	dir := newSupervisorTestDir(t, map[string]string{"a.yml": supervisorTestConfig, "b.yml": supervisorTestConfig})
+	defer os.RemoveAll(dir)
+
+	supervisor := newTestSupervisor(dir)
+	defer supervisor.Shutdown()
+	supervisor.scan(context.Background())
+
+	projects := supervisor.snapshot()
+	processNewPost(context.Background(), projects["a"].context, Post{Id: "1", Body: "hello", Feed: &Feed{Id: "so"}})
+
+	if posts := projects["b"].context.PostRepository.FindRecent(); len(posts) != 0 {
+		t.Fatalf("got %#v; expected no posts in the other project", posts)
+	}
+}
+
+func Test_Supervisor_ServeMux(t *testing.T) {
+	dir := newSupervisorTestDir(t, map[string]string{"a.yml": supervisorTestConfig})
+	defer os.RemoveAll(dir)
+
+	supervisor := newTestSupervisor(dir)
+	defer supervisor.Shutdown()
+	supervisor.scan(context.Background())
+	mux := supervisor.ServeMux()
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		return recorder
+	}
+
+	if body := serve("/").Body.String(); !strings.Contains(body, `href="projects/a/"`) {
+		t.Fatalf("got %s; expected a link to the project", body)
+	}
+
+	var statuses []ProjectStatus
+	if err := json.Unmarshal(serve("/api/projects").Body.Bytes(), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "a" || statuses[0].Feeds != 1 {
+		t.Fatalf("got %#v; expected the status of a", statuses)
+	}
+
+	if recorder := serve("/projects/a"); recorder.Code != 301 {
+		t.Fatalf("got status %d; expected redirect to the dashboard of the project", recorder.Code)
+	}
+	if recorder := serve("/projects/a/api/feeds"); recorder.Code != 200 || !strings.Contains(recorder.Body.String(), `"so"`) {
+		t.Fatalf("got %d %s; expected the feeds of the project", recorder.Code, recorder.Body.String())
+	}
+	if recorder := serve("/projects/nonexistent/"); recorder.Code != 404 {
+		t.Fatalf("got status %d; expected 404", recorder.Code)
+	}
+}
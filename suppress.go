@@ -0,0 +1,330 @@
+package xpd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SuppressionsConfig configures the false positives not to report
+type SuppressionsConfig struct {
+	// the suppressions are kept in File, managed with `xpd suppress` and the API
+	File string
+}
+
+type SuppressionKind string
+
+const (
+	// the matches of two posts with each other
+	SuppressPair SuppressionKind = "pair"
+	// the matches of any posts of a group with each other
+	SuppressCluster SuppressionKind = "cluster"
+	// the matches of the posts of an author
+	SuppressAuthor SuppressionKind = "author"
+	// the matches of the posts with a subject matching a regular expression
+	SuppressSubject SuppressionKind = "subject"
+	// the matches of the posts of a feed with the posts of another feed, or of the same feed
+	SuppressFeeds SuppressionKind = "feeds"
+)
+
+// Suppression stops matches from being reported, for example after a false positive
+type Suppression struct {
+	Id   int             `json:"id"`
+	Kind SuppressionKind `json:"kind"`
+	// the posts, of pair and cluster suppressions
+	Posts []SuppressedPost `json:"posts,omitempty"`
+	// the author, of author suppressions
+	Author string `json:"author,omitempty"`
+	// the regular expression, of subject suppressions
+	Subject string `json:"subject,omitempty"`
+	// the ids of the two feeds, of feeds suppressions
+	Feeds []string `json:"feeds,omitempty"`
+	// why the matches are not to be reported, for the record
+	Reason  string    `json:"reason,omitempty"`
+	Created time.Time `json:"created"`
+	// the suppression no longer applies after this time, if set
+	Expires *time.Time `json:"expires,omitempty"`
+
+	subject *regexp.Regexp
+}
+
+// SuppressedPost identifies a post by the id of its feed and its id, as post ids are unique only within a feed
+type SuppressedPost struct {
+	Feed string `json:"feed"`
+	Id   string `json:"id"`
+}
+
+// validate checks the fields of the kind are set, and compiles the subject
+func (suppression *Suppression) validate() error {
+	switch suppression.Kind {
+	case SuppressPair:
+		if len(suppression.Posts) != 2 || !suppression.identifiesPosts() {
+			return errors.New("pair: expected 2 posts, with the ids of their feeds")
+		}
+	case SuppressCluster:
+		if len(suppression.Posts) < 2 || !suppression.identifiesPosts() {
+			return errors.New("cluster: expected at least 2 posts, with the ids of their feeds")
+		}
+	case SuppressAuthor:
+		if suppression.Author == "" {
+			return errors.New("author: missing author")
+		}
+	case SuppressSubject:
+		subject, err := regexp.Compile(suppression.Subject)
+		if err != nil || suppression.Subject == "" {
+			return fmt.Errorf("subject: invalid regular expression: %q", suppression.Subject)
+		}
+		suppression.subject = subject
+	case SuppressFeeds:
+		if len(suppression.Feeds) != 2 || suppression.Feeds[0] == "" || suppression.Feeds[1] == "" {
+			return errors.New("feeds: expected 2 feed ids")
+		}
+	default:
+		return fmt.Errorf("unsupported suppression kind: %q", suppression.Kind)
+	}
+	return nil
+}
+
+func (suppression Suppression) identifiesPosts() bool {
+	for _, post := range suppression.Posts {
+		if post.Feed == "" || post.Id == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// includes tells if the post is one of the posts of the suppression
+func (suppression Suppression) includes(post Post) bool {
+	for _, suppressed := range suppression.Posts {
+		if suppressed.Feed == post.feedId() && suppressed.Id == post.Id {
+			return true
+		}
+	}
+	return false
+}
+
+func (suppression Suppression) expired(now time.Time) bool {
+	return suppression.Expires != nil && !now.Before(*suppression.Expires)
+}
+
+// suppresses tells if the match of the posts is suppressed
+func (suppression Suppression) suppresses(post, other Post) bool {
+	switch suppression.Kind {
+	case SuppressPair, SuppressCluster:
+		return suppression.includes(post) && suppression.includes(other)
+	case SuppressAuthor:
+		return post.Author == suppression.Author || other.Author == suppression.Author
+	case SuppressSubject:
+		return suppression.subject.MatchString(post.Subject) || suppression.subject.MatchString(other.Subject)
+	case SuppressFeeds:
+		first, second := suppression.Feeds[0], suppression.Feeds[1]
+		return post.feedId() == first && other.feedId() == second || post.feedId() == second && other.feedId() == first
+	}
+	return false
+}
+
+// SuppressionStore keeps suppressions in a file, read again when changed by another process,
+// such as `xpd suppress` while xpd is running
+type SuppressionStore struct {
+	path         string
+	mutex        sync.Mutex
+	suppressions []Suppression
+	// of the file when last read or written
+	modTime time.Time
+}
+
+// OpenSuppressionStore reads the suppressions of the file, if it exists
+func OpenSuppressionStore(path string) (*SuppressionStore, error) {
+	store := &SuppressionStore{path: path}
+	if err := store.refresh(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// refresh reads the file again if it changed, with the mutex locked
+func (store *SuppressionStore) refresh() error {
+	info, err := os.Stat(store.path)
+	if os.IsNotExist(err) {
+		store.suppressions, store.modTime = nil, time.Time{}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("suppressions: %s", err)
+	}
+	if info.ModTime().Equal(store.modTime) {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(store.path)
+	if err != nil {
+		return fmt.Errorf("suppressions: %s", err)
+	}
+	var suppressions []Suppression
+	if err := json.Unmarshal(content, &suppressions); err != nil {
+		return fmt.Errorf("suppressions: %s: %s", store.path, err)
+	}
+	for i := range suppressions {
+		if err := suppressions[i].validate(); err != nil {
+			return fmt.Errorf("suppressions: %s: suppression %d: %s", store.path, suppressions[i].Id, err)
+		}
+	}
+	store.suppressions, store.modTime = suppressions, info.ModTime()
+	return nil
+}
+
+// save writes the suppressions that have not expired, replacing the file atomically, with the mutex locked
+func (store *SuppressionStore) save() error {
+	now := time.Now()
+	active := []Suppression{}
+	for _, suppression := range store.suppressions {
+		if !suppression.expired(now) {
+			active = append(active, suppression)
+		}
+	}
+
+	content, err := json.MarshalIndent(active, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("suppressions: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("suppressions: %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("suppressions: %s", err)
+	}
+	if err := os.Rename(tmp.Name(), store.path); err != nil {
+		return fmt.Errorf("suppressions: %s", err)
+	}
+
+	store.suppressions = active
+	if info, err := os.Stat(store.path); err == nil {
+		store.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// List returns the suppressions that have not expired, oldest first
+func (store *SuppressionStore) List() ([]Suppression, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if err := store.refresh(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	suppressions := []Suppression{}
+	for _, suppression := range store.suppressions {
+		if !suppression.expired(now) {
+			suppressions = append(suppressions, suppression)
+		}
+	}
+	sort.SliceStable(suppressions, func(i, j int) bool {
+		return suppressions[i].Id < suppressions[j].Id
+	})
+	return suppressions, nil
+}
+
+// Add validates and saves the suppression, with a new id and creation time
+func (store *SuppressionStore) Add(suppression Suppression) (Suppression, error) {
+	if err := suppression.validate(); err != nil {
+		return Suppression{}, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if err := store.refresh(); err != nil {
+		return Suppression{}, err
+	}
+
+	suppression.Id = 1
+	for _, existing := range store.suppressions {
+		if existing.Id >= suppression.Id {
+			suppression.Id = existing.Id + 1
+		}
+	}
+	suppression.Created = time.Now()
+	store.suppressions = append(store.suppressions, suppression)
+	if err := store.save(); err != nil {
+		store.suppressions = store.suppressions[:len(store.suppressions)-1]
+		return Suppression{}, err
+	}
+	return suppression, nil
+}
+
+// Remove deletes the suppression with the id
+func (store *SuppressionStore) Remove(id int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if err := store.refresh(); err != nil {
+		return err
+	}
+
+	for i, suppression := range store.suppressions {
+		if suppression.Id == id {
+			previous := store.suppressions
+			store.suppressions = append(append([]Suppression{}, previous[:i]...), previous[i+1:]...)
+			if err := store.save(); err != nil {
+				store.suppressions = previous
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no such suppression: %d", id)
+}
+
+// filter returns the matches of the post that are not suppressed, and the ids of the suppressions applied.
+// A nil store suppresses nothing. If the file cannot be read, the suppressions last read apply.
+func (store *SuppressionStore) filter(post Post, matches []Post) ([]Post, []int) {
+	if store == nil {
+		return matches, nil
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if err := store.refresh(); err != nil {
+		log.Printf("error: %s", err)
+	}
+
+	now := time.Now()
+	var applied []int
+	kept := make([]Post, 0, len(matches))
+	for _, match := range matches {
+		suppressed := false
+		for _, suppression := range store.suppressions {
+			if !suppression.expired(now) && suppression.suppresses(post, match) {
+				suppressed = true
+				if !containsInt(applied, suppression.Id) {
+					applied = append(applied, suppression.Id)
+				}
+			}
+		}
+		if !suppressed {
+			kept = append(kept, match)
+		}
+	}
+	return kept, applied
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package xpd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_SuppressionStore_add_list_remove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenSuppressionStore(filepath.Join(dir, "suppressions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := store.Add(Suppression{Kind: SuppressPair, Posts: []SuppressedPost{{"so", "1"}, {"gg", "2"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := store.Add(Suppression{Id: 7, Kind: SuppressAuthor, Author: "jack"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Id != 1 || second.Id != 2 || second.Created.IsZero() {
+		t.Fatalf("got %#v, %#v; expected sequential ids and creation times", first, second)
+	}
+
+	if err := store.Remove(first.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Remove(first.Id); err == nil {
+		t.Fatal("got success; expected removing twice to fail")
+	}
+
+	// like `xpd suppress` while xpd is running
+	reopened, err := OpenSuppressionStore(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suppressions, _ := reopened.List(); len(suppressions) != 1 || suppressions[0].Author != "jack" {
+		t.Fatalf("got %#v; expected the remaining suppression saved", suppressions)
+	}
+}
+
+func Test_SuppressionStore_rejects_invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenSuppressionStore(filepath.Join(dir, "suppressions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, suppression := range []Suppression{
+		{Kind: SuppressPair, Posts: []SuppressedPost{{"so", "1"}}},
+		{Kind: SuppressPair, Posts: []SuppressedPost{{"so", "1"}, {Id: "2"}}},
+		{Kind: SuppressCluster},
+		{Kind: SuppressAuthor},
+		{Kind: SuppressSubject, Subject: "(unclosed"},
+		{Kind: SuppressFeeds, Feeds: []string{"so"}},
+		{Kind: "feed"},
+	} {
+		if _, err := store.Add(suppression); err == nil {
+			t.Errorf("got success; expected %#v rejected", suppression)
+		}
+	}
+}
+
+func Test_SuppressionStore_filter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenSuppressionStore(filepath.Join(dir, "suppressions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	for _, suppression := range []Suppression{
+		{Kind: SuppressCluster, Posts: []SuppressedPost{{"so", "1"}, {"so", "2"}, {"gg", "3"}}},
+		{Kind: SuppressAuthor, Author: "bot"},
+		{Kind: SuppressSubject, Subject: "^\\[ANN\\]"},
+		{Kind: SuppressAuthor, Author: "jill", Expires: &expired},
+		{Kind: SuppressFeeds, Feeds: []string{"ml", "so"}},
+	} {
+		if _, err := store.Add(suppression); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	post := Post{Id: "1", Author: "jill", Subject: "help", Feed: &Feed{Id: "so"}}
+	matches := []Post{
+		{Id: "2", Feed: &Feed{Id: "so"}},
+		{Id: "2", Feed: &Feed{Id: "gg"}},
+		{Id: "4", Author: "bot"},
+		{Id: "5", Subject: "[ANN] release"},
+		{Id: "6", Subject: "help"},
+		{Id: "7", Feed: &Feed{Id: "ml"}},
+		{Id: "8", Feed: &Feed{Id: "gg"}},
+	}
+	kept, applied := store.filter(post, matches)
+	if len(kept) != 3 || kept[0].feedId() != "gg" || kept[1].Id != "6" || kept[2].Id != "8" || len(applied) != 4 {
+		t.Fatalf("got %#v, %v; expected only the matches not suppressed, nor by an expired suppression, nor with the id of a suppressed post of another feed", kept, applied)
+	}
+
+	var nilStore *SuppressionStore
+	if kept, _ := nilStore.filter(post, matches); len(kept) != len(matches) {
+		t.Fatalf("got %#v; expected nothing suppressed without store", kept)
+	}
+}
+
+func Test_processNewPost_skips_suppressed_matches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenSuppressionStore(filepath.Join(dir, "suppressions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add(Suppression{Kind: SuppressPair, Posts: []SuppressedPost{{"so", "1"}, {"gg", "2"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := NewEventStore()
+	ctx := context.Background()
+	context := &Context{
+		Detectors:      []Detector{SameBodyDetector{}},
+		Listeners:      []Listener{events},
+		PostRepository: NewPostRepository(),
+		Suppressions:   store,
+	}
+	processNewPost(ctx, context, Post{Id: "1", Body: "hello", Feed: &Feed{Id: "so"}})
+	processNewPost(ctx, context, Post{Id: "2", Body: "hello", Feed: &Feed{Id: "gg"}})
+	processNewPost(ctx, context, Post{Id: "3", Body: "hello", Feed: &Feed{Id: "gg"}})
+
+	recent := events.FindRecent()
+	if len(recent) != 2 || recent[0].Post.Id != "3" || recent[1].Post.Id != "3" {
+		t.Fatalf("got %#v; expected only the matches of the post not suppressed reported", recent)
+	}
+}
+
+func Test_suppressions_api(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenSuppressionStore(filepath.Join(dir, "suppressions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := newApiTestContext()
+	context.Suppressions = store
+
+	body := `{"kind": "pair", "posts": [{"feed": "so", "id": "1"}, {"feed": "gg", "id": "3"}], "reason": "same team"}`
+	if code := request(t, context, "POST", "/api/suppressions", "application/json", body, nil); code != 201 {
+		t.Fatalf("got %d; expected 201", code)
+	}
+	if code := request(t, context, "POST", "/api/suppressions", "application/json", `{"kind": "pair"}`, nil); code != 400 {
+		t.Fatalf("got %d; expected 400 for an invalid suppression", code)
+	}
+	tooLarge := `{"kind": "pair", "posts": [{"feed": "so", "id": "1"}, {"feed": "gg", "id": "3"}], "reason": "` + strings.Repeat("x", maxApiRequestSize) + `"}`
+	if code := request(t, context, "POST", "/api/suppressions", "application/json", tooLarge, nil); code != 413 {
+		t.Fatalf("got %d; expected 413 for a request too large", code)
+	}
+
+	var suppressions []Suppression
+	request(t, context, "GET", "/api/suppressions", "", "", &suppressions)
+	if len(suppressions) != 1 || suppressions[0].Reason != "same team" {
+		t.Fatalf("got %#v; expected the added suppression", suppressions)
+	}
+
+	if code := request(t, context, "DELETE", "/api/suppressions/1", "", "", nil); code != 204 {
+		t.Fatalf("got %d; expected 204", code)
+	}
+	if code := request(t, context, "DELETE", "/api/suppressions/1", "", "", nil); code != 404 {
+		t.Fatalf("got %d; expected 404", code)
+	}
+}
+
+func Test_suppressions_api_not_configured(t *testing.T) {
+	if code := request(t, newApiTestContext(), "GET", "/api/suppressions", "", "", nil); code != 404 {
+		t.Fatalf("got %d; expected 404", code)
+	}
+}
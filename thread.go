@@ -0,0 +1,151 @@
+package xpd
+
+import (
+	"regexp"
+	"strings"
+)
+
+// threadUrlPattern finds the thread of a post in its URL, the first group being the thread
+type threadUrlPattern struct {
+	pattern *regexp.Regexp
+	// tells if the post of the URL replies to the thread, rather than starting it
+	reply func(match []string) bool
+}
+
+var threadUrlPatterns = []threadUrlPattern{
+	// Stack Exchange: answers are like /questions/{question}/{slug}/{answer}
+	{regexp.MustCompile(`^(https?://[^/]+/questions/\d+)(?:/[^/?#]*/(\d+))?`), func(match []string) bool {
+		return match[2] != ""
+	}},
+	// Discourse: posts are like /t/{slug}/{topic}/{number}, the first post of the topic being number 1
+	{regexp.MustCompile(`^(https?://[^/]+/t/(?:[^/?#]+/)?\d+)(?:/(\d+))?`), func(match []string) bool {
+		return match[2] != "" && match[2] != "1"
+	}},
+	// Google Groups: messages are like /d/msg/{group}/{thread}/{message} or /g/{group}/c/{thread}/m/{message}
+	{regexp.MustCompile(`^(https?://groups\.google\.com/(?:d/(?:msg|topic)|forum/#!(?:msg|topic))/[^/]+/[^/?#]+)`), nil},
+	{regexp.MustCompile(`^(https?://groups\.google\.com/g/[^/]+/c/[^/?#]+)`), nil},
+}
+
+// matches a prefix of the subject of a post: of replies like "Re:", or of lists like "[sonarqube]"
+var subjectPrefix = regexp.MustCompile(`^(?i)(?:((?:re|aw|sv|antw)(?:\[\d+\])?:)|\[[^\]]*\])\s*`)
+
+// parseSubject returns the subject without the prefixes of replies and lists, and if it is the subject of a reply
+func parseSubject(subject string) (string, bool) {
+	reply := false
+	subject = strings.TrimSpace(subject)
+	for {
+		match := subjectPrefix.FindStringSubmatch(subject)
+		if match == nil {
+			return subject, reply
+		}
+		if match[1] != "" {
+			reply = true
+		}
+		subject = subject[len(match[0]):]
+	}
+}
+
+// extractThread finds the thread of a post in its URLs, else its comments URL, else its subject,
+// and if the post is a reply to the thread, rather than starting it, returns the thread as parent.
+// Subjects are the threads of mailing lists, replies being like "Re: subject".
+func extractThread(urls []string, comments, subject string) (thread, parent string) {
+	topic, reply := parseSubject(subject)
+	for _, uri := range urls {
+		for _, urlPattern := range threadUrlPatterns {
+			match := urlPattern.pattern.FindStringSubmatch(uri)
+			if match == nil {
+				continue
+			}
+			if thread == "" {
+				thread = match[1]
+			}
+			if urlPattern.reply != nil && urlPattern.reply(match) {
+				reply = true
+			}
+		}
+	}
+	if thread == "" && comments != "" {
+		thread = comments
+	}
+	if thread == "" && topic != "" {
+		thread = "subject:" + strings.ToLower(topic)
+	}
+	if reply {
+		parent = thread
+	}
+	return thread, parent
+}
+
+// inSameThread is true if one of the posts replies to the other,
+// or replies to the thread of the other in the same feed.
+// Such posts are not compared, as replies quote the posts they answer.
+func inSameThread(post, other Post) bool {
+	if post.Parent != "" && post.Parent == other.Id || other.Parent != "" && other.Parent == post.Id {
+		return true
+	}
+	return post.Thread != "" && post.Thread == other.Thread && (post.Parent != "" || other.Parent != "") &&
+		post.Feed != nil && other.Feed != nil && post.Feed.Id == other.Feed.Id
+}
+
+// excludeThread returns the posts not in the same thread as the post
+func excludeThread(post Post, posts []Post) []Post {
+	for i, other := range posts {
+		if !inSameThread(post, other) {
+			continue
+		}
+		// copy, only if some posts are excluded
+		kept := append([]Post{}, posts[:i]...)
+		for _, other := range posts[i+1:] {
+			if !inSameThread(post, other) {
+				kept = append(kept, other)
+			}
+		}
+		return kept
+	}
+	return posts
+}
+
+// matches the attribution of quotes, like "On Mon, 1 Feb 2016, Jack wrote:"
+var quoteAttribution = regexp.MustCompile(`(?i)^(on|le|am) .+ (wrote|a écrit|schrieb):$`)
+
+// stripQuotes removes the quoted blocks of replies: <blockquote> elements, and lines starting with ">",
+// with their attribution.
+// Posts that are not replies are unchanged, as quotes in questions are often error messages or logs,
+// like posts that are nothing but quotes.
+func stripQuotes(post Post) Post {
+	if post.Parent == "" {
+		return post
+	}
+	body := stripBlockquotes(post.Body)
+
+	var kept []string
+	for _, segment := range splitSegments(body) {
+		text := segmentText(segment)
+		if strings.HasPrefix(text, ">") || quoteAttribution.MatchString(text) {
+			continue
+		}
+		kept = append(kept, segment)
+	}
+	body = strings.Join(kept, "")
+	if segmentText(body) == "" {
+		return post
+	}
+	post.Body = body
+	return post
+}
+
+// stripBlockquotes removes the <blockquote> elements, innermost first
+func stripBlockquotes(body string) string {
+	for {
+		lower := strings.ToLower(body)
+		start := strings.LastIndex(lower, "<blockquote")
+		if start < 0 {
+			return body
+		}
+		end := strings.Index(lower[start:], "</blockquote>")
+		if end < 0 {
+			return body[:start]
+		}
+		body = body[:start] + body[start+end+len("</blockquote>"):]
+	}
+}
@@ -0,0 +1,116 @@
+package xpd
+
+import (
+	"context"
+	rss "github.com/jteeuwen/go-pkg-rss"
+	"strings"
+	"testing"
+)
+
+func Test_extractThread(t *testing.T) {
+	for _, example := range []struct {
+		urls           []string
+		comments       string
+		subject        string
+		thread, parent string
+	}{
+		{[]string{"https://stackoverflow.com/questions/123/how-to"}, "", "How to?",
+			"https://stackoverflow.com/questions/123", ""},
+		{[]string{"https://stackoverflow.com/a/456", "https://stackoverflow.com/questions/123/how-to/456#456"}, "", "Answer to How to?",
+			"https://stackoverflow.com/questions/123", "https://stackoverflow.com/questions/123"},
+		{[]string{"https://forum.example.com/t/how-to/42/1"}, "", "How to?",
+			"https://forum.example.com/t/how-to/42", ""},
+		{[]string{"https://forum.example.com/t/how-to/42/3"}, "", "How to?",
+			"https://forum.example.com/t/how-to/42", "https://forum.example.com/t/how-to/42"},
+		{[]string{"https://groups.google.com/d/msg/sonarqube/abc/def"}, "", "Re: [sonarqube] How to?",
+			"https://groups.google.com/d/msg/sonarqube/abc", "https://groups.google.com/d/msg/sonarqube/abc"},
+		{[]string{"http://blog.example.com/post"}, "http://blog.example.com/post#comments", "Hello",
+			"http://blog.example.com/post#comments", ""},
+		{[]string{"http://lists.example.com/1"}, "", "RE: Aw: [list] How to?",
+			"subject:how to?", "subject:how to?"},
+		{[]string{"http://lists.example.com/2"}, "", "[list] How to?",
+			"subject:how to?", ""},
+		{[]string{""}, "", "", "", ""},
+	} {
+		thread, parent := extractThread(example.urls, example.comments, example.subject)
+		if thread != example.thread || parent != example.parent {
+			t.Errorf("got %q, %q; expected %q, %q for %v", thread, parent, example.thread, example.parent, example.urls)
+		}
+	}
+}
+
+func Test_itemHandler_sets_thread(t *testing.T) {
+	reader := NewRssReader("dummy url", Feed{}).(*rssReader)
+	link := rss.Link{Href: "https://groups.google.com/d/msg/sonarqube/abc/def"}
+	reader.itemHandler(nil, nil, []*rss.Item{{Title: "Re: How to?", Links: []*rss.Link{&link}}})
+
+	post := reader.newPosts[0]
+	if post.Thread != "https://groups.google.com/d/msg/sonarqube/abc" || post.Parent != post.Thread {
+		t.Fatalf("got %#v; expected the thread of the reply", post)
+	}
+}
+
+func Test_excludeThread(t *testing.T) {
+	so, gg := &Feed{Id: "so"}, &Feed{Id: "gg"}
+	question := Post{Id: "1", Thread: "t", Feed: so}
+	posts := []Post{
+		question,
+		{Id: "2", Thread: "t", Parent: "t", Feed: so},
+		{Id: "3", Thread: "t", Parent: "t", Feed: gg},
+		{Id: "4", Thread: "u", Feed: so},
+		{Id: "5", Thread: "t", Feed: so},
+	}
+
+	reply := Post{Id: "6", Thread: "t", Parent: "t", Feed: so}
+	if kept := excludeThread(reply, posts); len(kept) != 2 || kept[0].Id != "3" || kept[1].Id != "4" {
+		t.Fatalf("got %#v; expected the posts of the thread in the same feed excluded", kept)
+	}
+	direct := Post{Id: "7", Parent: "1", Feed: gg}
+	if kept := excludeThread(direct, posts); len(kept) != 4 || kept[0].Id != "2" {
+		t.Fatalf("got %#v; expected the parent excluded", kept)
+	}
+	// not a reply: a duplicate question in the same thread is still compared
+	if kept := excludeThread(Post{Id: "8", Thread: "t", Feed: so}, posts); len(kept) != 4 {
+		t.Fatalf("got %#v; expected only the replies of the thread excluded", kept)
+	}
+}
+
+func Test_stripQuotes(t *testing.T) {
+	reply := Post{Parent: "1", Body: "<p>Thanks, it works</p><blockquote><p>try <blockquote>nested</blockquote> this</p></blockquote>"}
+	if post := stripQuotes(reply); post.Body != "<p>Thanks, it works</p>" {
+		t.Fatalf("got %q; expected the blockquotes removed", post.Body)
+	}
+
+	reply.Body = "Thanks\nOn Mon, 1 Feb 2016, Jack wrote:\n> try this\n&gt; and that\n"
+	if post := stripQuotes(reply); post.Body != "Thanks\n" {
+		t.Fatalf("got %q; expected the quoted lines and attribution removed", post.Body)
+	}
+
+	question := Post{Body: "<p>I get:</p><blockquote>NullPointerException</blockquote>"}
+	if post := stripQuotes(question); post.Body != question.Body {
+		t.Fatalf("got %q; expected the quotes of posts that are not replies kept", post.Body)
+	}
+}
+
+func Test_processNewPost_does_not_match_replies_with_their_thread(t *testing.T) {
+	events := NewEventStore()
+	ctx := context.Background()
+	context := &Context{
+		Detectors:      []Detector{SameBodyDetector{}, NewSimilarWordCountDetector(0.2)},
+		Listeners:      []Listener{events},
+		PostRepository: NewPostRepository(),
+	}
+	gg := &Feed{Id: "gg"}
+	question := "<p>how to configure the quality gate of my project with many words</p>"
+
+	processNewPost(ctx, context, Post{Id: "1", Subject: "How to?", Body: question, Thread: "t", Feed: gg})
+	processNewPost(ctx, context, Post{Id: "2", Subject: "Re: How to?", Body: question, Thread: "t", Parent: "t", Feed: gg})
+	processNewPost(ctx, context, Post{Id: "3", Subject: "Re: How to?", Body: "<p>ok</p><blockquote>" + question + "</blockquote>", Thread: "t", Parent: "t", Feed: gg})
+
+	if recent := events.FindRecent(); len(recent) != 0 {
+		t.Fatalf("got %#v; expected no matches within the thread", recent)
+	}
+	if recent := context.PostRepository.FindRecent(); !strings.HasPrefix(recent[2].Body, "<p>ok</p><blockquote>") || recent[2].stripped != "<p>ok</p>" {
+		t.Fatalf("got %#v; expected the reply stored as fetched, compared without quotes", recent[2])
+	}
+}
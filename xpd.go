@@ -1,76 +1,260 @@
 package xpd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/xpd-org/xpd/mail"
-	"gopkg.in/yaml.v2"
+	"github.com/xpd-org/xpd/secret"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 )
 
 // poll RSS feeds once per 15 minutes
 const rssPollingMillis = 1000 * 60 * 15
 
-// number of recent posts to keep in memory
+// number of recent posts to keep in memory, by default
 const defaultPostRepositoryCapacity = 10000
 
+const defaultShutdownTimeout = 30 * time.Second
+
 type Post struct {
 	Id      string
 	Url     string
 	Author  string
 	Subject string
 	Body    string
-	Feed    *Feed
+	// publication time
+	Time time.Time
+	Feed *Feed
+	// identifies the thread of the post in its feed, like the question of answers, or the subject of emails; empty if unknown
+	Thread string
+	// the id of the post this post replies to, or its Thread if the post replies to the thread; empty if not a reply
+	Parent string
+	// the post was fetched before with a different content, and replaces the post of the same feed and id
+	Edited bool
+
+	// the body compared by the detectors, without boilerplate and quotes; empty if the same as Body
+	stripped string
+	// the body as fetched, in the copies of posts compared by the detectors
+	fetched string
 }
 
 type Feed struct {
 	Id  string
 	Url string
+	// regular expressions of the lines to remove from posts before detection, like the footers of mailing lists
+	IgnorePatterns []string `yaml:"ignorePatterns"`
 }
 
+// The context.Context arguments of FeedReader, Detector and Listener methods
+// are cancelled when the work is no longer needed, for example on shutdown.
+
 type FeedReader interface {
 	GetFeed() Feed
-	FetchNewPosts() []Post
+	FetchNewPosts(context.Context) ([]Post, error)
 }
 
 type Detector interface {
-	FindDuplicates(Post, []Post) []Post
+	FindDuplicates(context.Context, Post, []Post) []Post
+}
+
+// Scorer is implemented by detectors that can tell how similar two posts are,
+// from 0 (nothing in common) to 1 (the same)
+type Scorer interface {
+	Score(Post, Post) float64
+}
+
+// Explainer is implemented by detectors that can tell why they consider a post similar to an older post or not
+type Explainer interface {
+	Explain(Post, Post) Explanation
+}
+
+// Explanation is what a detector compares, with its thresholds
+type Explanation struct {
+	// like "word count diffs: 3 < 4.2"
+	Details []string
+	// the values compared, the first row being the header
+	Table [][]string
 }
 
 type Listener interface {
-	OnCrossPost(Post, []Post)
-	OnDuplicate(Post, []Post)
+	OnCrossPost(context.Context, Post, []Post) error
+	OnDuplicate(context.Context, Post, []Post) error
+}
+
+// EventListener is implemented by listeners that need the details of events,
+// such as the detector that found the match
+type EventListener interface {
+	OnEvent(context.Context, Event) error
 }
 
+type EventKind string
+
+const (
+	DuplicateEvent EventKind = "duplicate"
+	CrossPostEvent EventKind = "cross-post"
+	// an edited post no longer matches any of the Posts it matched before its edit
+	NoLongerMatchesEvent EventKind = "no-longer-matches"
+)
+
+// Event is a new post found to be a duplicate or cross-post of older posts
+// by a detector, with a score of similarity between 0 and 1
+type Event struct {
+	Kind     EventKind
+	Post     Post
+	Posts    []Post
+	Time     time.Time
+	Detector string
+	Score    float64
+	// the post became a duplicate or cross-post by an edit
+	Edited bool
+}
+
+func newEvent(kind EventKind, post Post, posts []Post) Event {
+	return Event{Kind: kind, Post: post, Posts: posts, Time: time.Now()}
+}
+
+func newDetectorEvent(kind EventKind, detector Detector, post Post, posts []Post) Event {
+	event := newEvent(kind, post, posts)
+	event.Detector = detectorName(detector)
+	event.Score = bestScore(detector, post, posts)
+	return event
+}
+
+func (event Event) notify(ctx context.Context, listener Listener) error {
+	if eventListener, ok := listener.(EventListener); ok {
+		return eventListener.OnEvent(ctx, event)
+	}
+	switch event.Kind {
+	case CrossPostEvent:
+		return listener.OnCrossPost(ctx, event.Post, event.Posts)
+	case DuplicateEvent:
+		return listener.OnDuplicate(ctx, event.Post, event.Posts)
+	case NoLongerMatchesEvent:
+		// not supported by plain listeners
+		return nil
+	}
+	return fmt.Errorf("unknown event kind: %s", event.Kind)
+}
+
+// handlesEvents tells if the listener, or the listener queued by it, is an EventListener
+func handlesEvents(listener Listener) bool {
+	if queue, ok := listener.(*QueuedListener); ok {
+		listener = queue.Listener
+	}
+	_, ok := listener.(EventListener)
+	return ok
+}
+
+// postKey identifies a post: posts of different feeds may have the same id
+func postKey(post Post) string {
+	return post.feedId() + " " + post.Id
+}
+
+func (post Post) feedId() string {
+	if post.Feed == nil {
+		return ""
+	}
+	return post.Feed.Id
+}
+
+// PostRepository keeps the recent posts, unique by feed and id
 type PostRepository interface {
 	FindRecent() []Post
+	// Add adds the post, or replaces the post of the same feed and id, keeping its position
 	Add(Post)
+	// Get returns the post of the feed with the id, or false if there is none
+	Get(feedId, id string) (Post, bool)
 }
 
 type defaultPostRepository struct {
 	posts    []Post
 	capacity int
+	// maximum number of posts of each feed, none if 0
+	feedQuota int
+	// posts published longer ago are evicted on compaction, never if 0
+	maxAge time.Duration
+	// the sequence numbers of the posts, in the order of posts, to find the position of a post
+	seqs []int
+	// the sequence number of the next post
+	next int
+	// the sequence numbers of the posts by postKey
+	index map[string]int
+	// the sequence numbers of the posts of each feed, oldest first
+	feeds map[string][]int
+	// counts the evictions, if not nil
+	metrics *Metrics
+	// guards the fields above, for readers other than the main loop, such as the dashboard
+	mutex sync.RWMutex
 }
 
 func NewPostRepository() PostRepository {
-	return &defaultPostRepository{capacity: defaultPostRepositoryCapacity}
+	return newPostRepository(RepositoryConfig{}, nil)
 }
 
-func (repo defaultPostRepository) FindRecent() []Post {
+func (repo *defaultPostRepository) FindRecent() []Post {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
 	return repo.posts
 }
 
 func (repo *defaultPostRepository) Add(post Post) {
-	var posts []Post
-	if len(repo.posts) < repo.capacity {
-		posts = repo.posts
-	} else {
-		posts = repo.posts[1:]
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	if repo.index == nil {
+		repo.index = make(map[string]int)
+		repo.feeds = make(map[string][]int)
+	}
+	key := postKey(post)
+	if seq, ok := repo.index[key]; ok {
+		// copy, as FindRecent returns the slice to readers without the lock
+		posts := append([]Post{}, repo.posts...)
+		posts[repo.position(seq)] = post
+		repo.posts = posts
+		return
+	}
+
+	feedId := post.feedId()
+	if seqs := repo.feeds[feedId]; repo.feedQuota > 0 && len(seqs) >= repo.feedQuota {
+		repo.evictAt(repo.position(seqs[0]), evictedByQuota)
 	}
-	repo.posts = append(posts, post)
+	if len(repo.posts) >= repo.capacity {
+		repo.forget(repo.posts[0], evictedByCount)
+		repo.posts = repo.posts[1:]
+		repo.seqs = repo.seqs[1:]
+	}
+	seq := repo.next
+	repo.next++
+	repo.index[key] = seq
+	repo.feeds[feedId] = append(repo.feeds[feedId], seq)
+	repo.posts = append(repo.posts, post)
+	repo.seqs = append(repo.seqs, seq)
+}
+
+// position returns the position in posts of the post with the sequence number
+func (repo *defaultPostRepository) position(seq int) int {
+	return sort.SearchInts(repo.seqs, seq)
+}
+
+func (repo *defaultPostRepository) Get(feedId, id string) (Post, bool) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
+	seq, ok := repo.index[feedId+" "+id]
+	if !ok {
+		return Post{}, false
+	}
+	return repo.posts[repo.position(seq)], true
 }
 
 type TypeConfig struct {
@@ -78,26 +262,42 @@ type TypeConfig struct {
 	Params map[string]string
 }
 
+type ListenerConfig struct {
+	TypeConfig `yaml:",inline"`
+	Digest     *DigestConfig
+	Filter     *FilterConfig
+}
+
 type Config struct {
-	Feeds     []Feed
-	Detectors []TypeConfig
-	Listeners []TypeConfig
+	Feeds        []Feed
+	Detectors    []TypeConfig
+	Listeners    []ListenerConfig
+	Dispatch     DispatchConfig
+	HTTP         HTTPConfig `yaml:"http"`
+	Repository   RepositoryConfig
+	Suppressions SuppressionsConfig
+	Boilerplate  BoilerplateConfig
+	// maximum time to deliver pending events on shutdown, default 30s
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+
+	// the file the configuration was read from, watched for changes
+	path string
 }
 
-func ParseConfig(path string) (*Config, error) {
-	yamlFile, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, err
+func (config *Config) shutdownTimeout() time.Duration {
+	if config.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
 	}
+	return config.ShutdownTimeout
+}
 
-	var config Config
-
-	err = yaml.Unmarshal(yamlFile, &config)
+func ParseConfig(path string) (*Config, error) {
+	yamlFile, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	return parseConfig(path, yamlFile)
 }
 
 type Context struct {
@@ -105,71 +305,141 @@ type Context struct {
 	Detectors      []Detector
 	Listeners      []Listener
 	PostRepository PostRepository
+	Monitor        *FeedMonitor
+	Events         *EventStore
+	Metrics        *Metrics
+	// where the repository is saved on shutdown, if not empty
+	RepositoryFile string
+	// the matches not to report, nil if not configured
+	Suppressions *SuppressionStore
+
+	// removes the boilerplate of new posts
+	boilerplate *boilerplate
+	// the configuration in effect
+	config *Config
+	// how readers get the content of feeds
+	fetch fetchFunc
+	// the first fetch of each reader, also of the feeds added on reload, is backfilled
+	backfill bool
+	// new configurations to apply, see reload
+	reloads <-chan *Config
+	// guards Readers, Detectors and Listeners, replaced on reload,
+	// for readers other than the main loop, such as the API and the detections
+	mutex sync.RWMutex
+	// serializes the notifications of the detections running in parallel
+	notifying sync.Mutex
+	// old listeners delivering their pending events after a reload
+	draining sync.WaitGroup
 }
 
-func ParseContext(config *Config) (*Context, error) {
+func checkConfig(config *Config) error {
 	if len(config.Feeds) == 0 {
-		return nil, errors.New("configuration error: configure at least one feed")
+		return errors.New("configuration error: configure at least one feed")
 	}
 
 	if len(config.Detectors) == 0 {
-		return nil, errors.New("configuration error: configure at least one detector")
+		return errors.New("configuration error: configure at least one detector")
 	}
 
-	readers := parseReaders(config)
+	return nil
+}
+
+func ParseContext(config *Config) (*Context, error) {
+	return newContext(config, fetchFeed)
+}
+
+func newContext(config *Config, fetch fetchFunc) (*Context, error) {
+	if err := checkConfig(config); err != nil {
+		return nil, err
+	}
+
+	monitor := NewFeedMonitor()
+	metrics := NewMetrics()
+	readers, err := parseReaders(config, monitor, metrics, fetch)
+	if err != nil {
+		return nil, err
+	}
 
 	detectors, err := parseDetectors(config.Detectors)
 	if err != nil {
 		return nil, err
 	}
 
-	extraListeners, err := parseListeners(config.Listeners)
+	extraListeners, err := parseListeners(config.Listeners, config.Dispatch, metrics)
 	if err != nil {
 		return nil, err
 	}
 
-	listeners := []Listener{ConsolePrinterListener{}}
+	events := NewEventStore()
+	listeners := []Listener{ConsolePrinterListener{}, events}
 	listeners = append(listeners, extraListeners...)
 
+	repo := newPostRepository(config.Repository, metrics)
+	if config.Repository.File != "" {
+		if err := loadPosts(repo, config.Repository.File, config.Feeds); err != nil {
+			return nil, err
+		}
+		repo.compact(time.Now())
+	}
+
+	boilerplate, err := newBoilerplate(config.Boilerplate, config.Feeds)
+	if err != nil {
+		return nil, err
+	}
+
+	var suppressions *SuppressionStore
+	if config.Suppressions.File != "" {
+		if suppressions, err = OpenSuppressionStore(config.Suppressions.File); err != nil {
+			return nil, err
+		}
+	}
+
 	context := &Context{
 		Readers:        readers,
 		Detectors:      detectors,
 		Listeners:      listeners,
-		PostRepository: NewPostRepository(),
+		PostRepository: repo,
+		Monitor:        monitor,
+		Events:         events,
+		Metrics:        metrics,
+		RepositoryFile: config.Repository.File,
+		Suppressions:   suppressions,
+		boilerplate:    boilerplate,
+		config:         config,
+		fetch:          fetch,
 	}
 	return context, nil
 }
 
-func parseReaders(config *Config) []FeedReader {
+func parseReaders(config *Config, monitor *FeedMonitor, metrics *Metrics, fetch fetchFunc) ([]FeedReader, error) {
 	readers := make([]FeedReader, len(config.Feeds))
 	for i, feed := range config.Feeds {
-		log.Println("adding feed:", feed.Id, feed.Url)
-		readers[i] = NewRssReader(feed.Url, feed)
+		reader, err := parseReader(feed, monitor, metrics, fetch)
+		if err != nil {
+			return nil, err
+		}
+		readers[i] = reader
+	}
+	return readers, nil
+}
+
+// parseReader creates the reader of a feed, its URL interpolated like params,
+// while Feed.Url keeps the configured value, to show without secrets
+func parseReader(feed Feed, monitor *FeedMonitor, metrics *Metrics, fetch fetchFunc) (FeedReader, error) {
+	uri, err := interpolate(feed.Url)
+	if err != nil {
+		return nil, fmt.Errorf("feed %s: %s", feed.Id, err)
 	}
-	return readers
+	log.Println("adding feed:", feed.Id, feed.Url)
+	return newMonitoredReader(newRssReader(uri, feed, fetch), monitor, metrics), nil
 }
 
 func parseDetectors(items []TypeConfig) ([]Detector, error) {
 	detectors := make([]Detector, len(items))
 	for i, config := range items {
-		var detector Detector
-		switch config.Type {
-		default:
-			return nil, fmt.Errorf("unsupported detector type: %s", config.Type)
-		case "SimilarWordCountDetector":
-			var maxDiffRatio float64
-			if s, ok := config.Params["maxDiffRatio"]; ok {
-				if value, err := strconv.ParseFloat(s, 64); err != nil {
-					return nil, err
-				} else {
-					maxDiffRatio = value
-				}
-			} else {
-				maxDiffRatio = 0.1
-			}
-			detector = NewSimilarWordCountDetector(maxDiffRatio)
-		case "SameBodyDetector":
-			detector = SameBodyDetector{}
+		detector, err := parseDetector(config)
+		if err != nil {
+			return nil, err
 		}
 		log.Printf("adding detector: %#v", detector)
 		detectors[i] = detector
@@ -177,30 +447,99 @@ func parseDetectors(items []TypeConfig) ([]Detector, error) {
 	return detectors, nil
 }
 
-func parseListeners(items []TypeConfig) ([]Listener, error) {
-	listeners := make([]Listener, len(items))
-	for i, config := range items {
-		var listener Listener
-		switch config.Type {
-		default:
-			return nil, fmt.Errorf("unsupported listener type: %s", config.Type)
-		case "gmail":
-			listener = MailerListener{
-				Mailer: mail.GmailMailer{
-					From:      config.Params["from"],
-					Pass:      config.Params["pass"],
-					Recipient: config.Params["recipient"],
-					Subject:   config.Params["subject"],
-				},
+func parseDetector(config TypeConfig) (Detector, error) {
+	params, err := interpolateParams(config.Params)
+	if err != nil {
+		return nil, err
+	}
+	switch config.Type {
+	case "SimilarWordCountDetector":
+		maxDiffRatio := 0.1
+		if s, ok := params["maxDiffRatio"]; ok {
+			value, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, err
 			}
+			maxDiffRatio = value
+		}
+		return NewSimilarWordCountDetector(maxDiffRatio), nil
+	case "SameBodyDetector":
+		return SameBodyDetector{}, nil
+	}
+	return nil, fmt.Errorf("unsupported detector type: %s", config.Type)
+}
+
+func parseListeners(items []ListenerConfig, dispatch DispatchConfig, metrics *Metrics) (listeners []Listener, err error) {
+	defer func() {
+		// stop the queues and digests already started
+		if err != nil {
+			shutdownListeners(context.Background(), listeners)
+		}
+	}()
+
+	for _, config := range items {
+		listener, err := parseListener(config.TypeConfig)
+		if err != nil {
+			return listeners, err
+		}
+		var filter *EventFilter
+		if config.Filter != nil {
+			if filter, err = NewEventFilter(*config.Filter); err != nil {
+				return listeners, err
+			}
+		}
+		queue := NewQueuedListener(listener, dispatch)
+		queue.Name = fmt.Sprintf("%s-%d", config.Type, len(listeners)+1)
+		queue.Metrics = metrics
+		listener = queue
+		if config.Digest != nil {
+			digest, err := NewDigestListener(listener, *config.Digest)
+			if err != nil {
+				queue.Close()
+				return listeners, err
+			}
+			listener = digest
+		}
+		if filter != nil {
+			listener = &FilteredListener{Listener: listener, Filter: filter}
 		}
 		log.Printf("adding listener: %v", listener)
-		listeners[i] = listener
+		listeners = append(listeners, listener)
 	}
 	return listeners, nil
 }
 
-// the default number of posts to read; normally infinity, set to 0 by some tests
+func parseListener(config TypeConfig) (Listener, error) {
+	params, err := interpolateParams(config.Params)
+	if err != nil {
+		return nil, err
+	}
+	switch config.Type {
+	case "gmail":
+		return MailerListener{
+			Mailer: mail.GmailMailer{
+				From:      params["from"],
+				Pass:      secret.Value(params["pass"]),
+				Recipient: params["recipient"],
+				Subject:   params["subject"],
+			},
+		}, nil
+	case "comment":
+		return NewCommentListener(params)
+	case "exec":
+		listener, err := NewExecListener(params)
+		if err != nil {
+			return nil, err
+		}
+		listener.configured = config.Params["command"]
+		return listener, nil
+	case "jsonl":
+		return NewJsonlListener(params)
+	}
+	return nil, fmt.Errorf("unsupported listener type: %s", config.Type)
+}
+
+// the default number of posts to read: infinity
 var defaultCount int
 
 func init() {
@@ -213,74 +552,218 @@ func getDefaultCount() int {
 	return maxInt
 }
 
+// RunOptions change how Run processes the feeds
+type RunOptions struct {
+	// fetch each feed once, process the new posts, and stop, instead of running until stopped
+	Once bool
+	// add the posts of the first fetch of each feed to the repository, without detecting matches,
+	// so that the posts already in the feeds are not reported
+	Backfill bool
+	// save the documents fetched to this directory, to replay later
+	Record string
+	// instead of fetching, process the documents recorded in this directory, in order, and stop
+	Replay string
+}
+
+// fetch is how readers get the content of feeds with these options
+func (options RunOptions) fetch() fetchFunc {
+	if options.Record != "" {
+		return recordFetches(options.Record, fetchFeed)
+	}
+	return fetchFeed
+}
+
 func RunForever(path string) error {
+	return Run(path, RunOptions{})
+}
+
+func Run(path string, options RunOptions) error {
 	config, err := ParseConfig(path)
 	if err != nil {
 		return err
 	}
 
-	return runForever(config)
+	switch {
+	case options.Replay != "":
+		return replayAndShutdown(config, options)
+	case options.Once:
+		return runOnceAndShutdown(config, options)
+	}
+	return runForeverWithOptions(config, options)
 }
 
-func runForever(config *Config) error {
-	context, err := ParseContext(config)
+// runForeverWithOptions runs until SIGINT or SIGTERM, then shuts down gracefully
+func runForeverWithOptions(config *Config, options RunOptions) error {
+	xpdContext, err := newContext(config, options.fetch())
 	if err != nil {
 		return err
 	}
+	if options.Backfill {
+		backfillReaders(xpdContext)
+	}
 
-	run(context, defaultCount)
+	var server *http.Server
+	if config.HTTP.Addr != "" {
+		server = startHTTP(xpdContext, config.HTTP)
+	}
 
-	return nil
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if config.path != "" {
+		reloads := make(chan *Config)
+		xpdContext.reloads = reloads
+		go watchConfig(ctx, config.path, reloads)
+	}
+	run(ctx, xpdContext, defaultCount)
+	// a second signal kills the process, without waiting for the shutdown
+	stop()
+
+	// the timeout of the last configuration applied
+	timeout := xpdContext.config.shutdownTimeout()
+	log.Printf("shutting down, waiting at most %s", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err = xpdContext.Shutdown(shutdownCtx)
+	if server != nil {
+		server.Shutdown(shutdownCtx)
+	}
+	return err
 }
 
-func run(context *Context, count int) {
+// run processes count new posts, or until ctx is cancelled,
+// applying new configurations and compacting the repository between posts.
+// Posts are admitted in the order they are fetched, and their detections run in parallel for different feeds.
+// The posts admitted when ctx is cancelled are processed completely.
+func run(ctx context.Context, context *Context, count int) {
 	posts := make(chan Post)
 
+	pool := newReaderPool(ctx, posts, count)
 	for _, reader := range context.Readers {
-		go waitForPosts(reader, posts, count)
+		pool.start(reader)
 	}
-
-	for i := 0; i < count; i++ {
-		post := <-posts
-		processNewPost(context, post)
+	detections := newDetectionPool(ctx, context)
+	defer detections.wait()
+	compactions := time.NewTicker(context.compactInterval())
+	defer compactions.Stop()
+
+	for i := 0; i < count; {
+		select {
+		case post := <-posts:
+			if detection, ok := admitPost(context, post); ok {
+				detections.submit(detection)
+			}
+			i++
+		case config := <-context.reloads:
+			// the detections running notify the current listeners, before they are drained
+			detections.wait()
+			if err := context.reload(config, pool); err != nil {
+				log.Printf("error: rejecting new configuration, keeping the current one: %s", err)
+			}
+			compactions.Reset(context.compactInterval())
+		case now := <-compactions.C:
+			compactRepository(context, now)
+		case <-ctx.Done():
+			pool.wait()
+			return
+		}
 	}
 }
 
-func waitForPosts(reader FeedReader, posts chan<- Post, count int) {
+func waitForPosts(ctx context.Context, reader FeedReader, posts chan<- Post, count int) {
 	log.Println("listening on feed:", reader.GetFeed().Id)
 	for i := 0; i < count; i++ {
-		for _, post := range reader.FetchNewPosts() {
-			posts <- post
+		newPosts, err := reader.FetchNewPosts(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("error: %s", err)
+		}
+		for _, post := range newPosts {
+			select {
+			case posts <- post:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-time.After(rssPollingMillis * time.Millisecond):
+		case <-ctx.Done():
+			return
 		}
-		time.Sleep(rssPollingMillis * time.Millisecond)
 	}
 }
 
-func processNewPost(context *Context, post Post) {
-	repo := context.PostRepository
-	recent := repo.FindRecent()
+// processNewPost admits the post and runs its detection, for callers processing posts one by one
+func processNewPost(ctx context.Context, context *Context, post Post) {
+	if detection, ok := admitPost(context, post); ok {
+		detection.run(ctx, context)
+	}
+}
 
-	for _, detector := range context.Detectors {
-		possibleDuplicates := detector.FindDuplicates(post, recent)
+// detect returns the matches of the post found by the first detector finding any, without the suppressed matches
+func detect(ctx context.Context, context *Context, post Post, recent []Post) (Detector, []Post) {
+	metrics := context.Metrics
+	detectors, _ := context.components()
+	for _, detector := range detectors {
+		name := detectorName(detector)
+		start := time.Now()
+		possibleDuplicates := detector.FindDuplicates(ctx, post, recent)
+		metrics.ObserveSince("xpd_detector_duration_seconds", start, name)
+		possibleDuplicates, suppressed := context.Suppressions.filter(post, possibleDuplicates)
+		if len(suppressed) > 0 {
+			log.Printf("suppressed match(es) of %s by %s, with suppression(s) %v", post.Id, name, suppressed)
+			metrics.Add("xpd_suppressed_matches_total", 1, name)
+		}
 		if len(possibleDuplicates) > 0 {
-			dups, cross := splitDupsAndCrossPosts(post, possibleDuplicates)
-			if len(dups) > 0 {
-				for _, listener := range context.Listeners {
-					// TODO add Detector ref as param
-					listener.OnDuplicate(post, dups)
-				}
-			}
-			if len(cross) > 0 {
-				for _, listener := range context.Listeners {
-					// TODO add Detector ref as param
-					listener.OnCrossPost(post, cross)
-				}
-			}
-			break
+			return detector, possibleDuplicates
 		}
 	}
+	return nil, nil
+}
 
-	repo.Add(post)
+// notifyMatches notifies the listeners of the matches in the same feed as a duplicate event,
+// and of the matches in other feeds as a cross-post event
+func notifyMatches(ctx context.Context, context *Context, detector Detector, post Post, matches []Post, edited bool) {
+	if len(matches) == 0 {
+		return
+	}
+	metrics := context.Metrics
+	name := detectorName(detector)
+	dups, cross := splitDupsAndCrossPosts(post, matches)
+	if len(dups) > 0 {
+		metrics.Add("xpd_detector_matches_total", 1, name, string(DuplicateEvent))
+		event := newDetectorEvent(DuplicateEvent, detector, post, dups)
+		event.Edited = edited
+		notifyListeners(ctx, context, event)
+	}
+	if len(cross) > 0 {
+		metrics.Add("xpd_detector_matches_total", 1, name, string(CrossPostEvent))
+		event := newDetectorEvent(CrossPostEvent, detector, post, cross)
+		event.Edited = edited
+		notifyListeners(ctx, context, event)
+	}
+}
+
+// notifyListeners notifies the listeners one event at a time, from any goroutine,
+// so that listeners do not need to be safe for concurrent use.
+// The posts compared by the detectors are notified as fetched.
+func notifyListeners(ctx context.Context, context *Context, event Event) {
+	event.Post = event.Post.asFetched()
+	posts := make([]Post, len(event.Posts))
+	for i, post := range event.Posts {
+		posts[i] = post.asFetched()
+	}
+	event.Posts = posts
+
+	context.notifying.Lock()
+	defer context.notifying.Unlock()
+	_, listeners := context.components()
+	for _, listener := range listeners {
+		if err := event.notify(ctx, listener); err != nil {
+			log.Printf("error: %v: %s", listener, err)
+		}
+	}
 }
 
 func splitDupsAndCrossPosts(post Post, posts []Post) ([]Post, []Post) {
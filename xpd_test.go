@@ -1,9 +1,12 @@
 package xpd
 
 import (
+	"context"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_defaultPostRepository_should_cycle_posts_to_keep_capacity(t *testing.T) {
@@ -25,6 +28,31 @@ func Test_defaultPostRepository_should_cycle_posts_to_keep_capacity(t *testing.T
 	}
 }
 
+func Test_defaultPostRepository_upserts_by_feed_and_id(t *testing.T) {
+	so, gg := &Feed{Id: "so"}, &Feed{Id: "gg"}
+	repo := &defaultPostRepository{capacity: 3}
+	repo.Add(Post{Id: "1", Body: "a", Feed: so})
+	repo.Add(Post{Id: "1", Body: "b", Feed: gg})
+	repo.Add(Post{Id: "1", Body: "c", Feed: so})
+
+	if recent := repo.FindRecent(); len(recent) != 2 || recent[0].Body != "c" || recent[1].Body != "b" {
+		t.Fatalf("got %#v; expected the post of the same feed and id replaced in place", recent)
+	}
+
+	repo.Add(Post{Id: "2", Feed: so})
+	repo.Add(Post{Id: "3", Feed: so})
+	if _, ok := repo.Get("so", "1"); ok {
+		t.Fatal("got evicted post; expected none")
+	}
+	if post, ok := repo.Get("gg", "1"); !ok || post.Body != "b" {
+		t.Fatalf("got %#v, %t; expected the post of gg", post, ok)
+	}
+	repo.Add(Post{Id: "2", Body: "d", Feed: so})
+	if recent := repo.FindRecent(); len(recent) != 3 || recent[1].Body != "d" {
+		t.Fatalf("got %#v; expected the post replaced at its position after evictions", recent)
+	}
+}
+
 func assertPanic(t *testing.T, message string, f func()) {
 	defer func() {
 		if r := recover(); r == nil {
@@ -84,14 +112,14 @@ func Test_ParseContext(t *testing.T) {
 	}
 
 	brokenConfig = *config
-	brokenConfig.Listeners = []TypeConfig{{Type: "nonexistent"}}
+	brokenConfig.Listeners = []ListenerConfig{{TypeConfig: TypeConfig{Type: "nonexistent"}}}
 	if _, err := ParseContext(&brokenConfig); err == nil {
 		t.Error("config parser should fail with invalid listener")
 	}
 }
 
 func Test_parseListeners_gmail(t *testing.T) {
-	listeners, err := parseListeners([]TypeConfig{{Type: "gmail"}})
+	listeners, err := parseListeners([]ListenerConfig{{TypeConfig: TypeConfig{Type: "gmail"}}}, DispatchConfig{}, nil)
 	if err != nil {
 		t.Fatalf("got error: %s; expected successful parsing of gmail sender listener", err)
 	}
@@ -191,27 +219,30 @@ type mockListener struct {
 	invokedWithCross bool
 }
 
-func (listener *mockListener) OnCrossPost(Post, []Post) {
+func (listener *mockListener) OnCrossPost(context.Context, Post, []Post) error {
 	listener.invokedWithCross = true
+	return nil
 }
 
-func (listener *mockListener) OnDuplicate(Post, []Post) {
+func (listener *mockListener) OnDuplicate(context.Context, Post, []Post) error {
 	listener.invokedWithDups = true
+	return nil
 }
 
 func Test_processPost(t *testing.T) {
-	post := Post{Feed: &Feed{Id: "p1"}}
+	post := Post{Id: "1", Feed: &Feed{Id: "p1"}}
 
 	listener := &mockListener{}
 	repo := NewPostRepository()
 
+	ctx := context.Background()
 	context := &Context{
 		Detectors:      []Detector{SameBodyDetector{}},
 		Listeners:      []Listener{listener},
 		PostRepository: repo,
 	}
 
-	processNewPost(context, post)
+	processNewPost(ctx, context, post)
 	if listener.invokedWithDups || listener.invokedWithCross {
 		t.Error("mock listener was invoked, but should not have been")
 	}
@@ -219,7 +250,12 @@ func Test_processPost(t *testing.T) {
 		t.Fatal("got != 1 recent posts, expected one dummy post added")
 	}
 
-	processNewPost(context, post)
+	processNewPost(ctx, context, post)
+	if listener.invokedWithDups || len(repo.FindRecent()) != 1 {
+		t.Fatal("got the dummy post added twice; expected the post fetched again ignored")
+	}
+
+	processNewPost(ctx, context, Post{Id: "2", Feed: post.Feed})
 	if !listener.invokedWithDups {
 		t.Error("mock listener should have been invoked, but it was not")
 	}
@@ -227,7 +263,7 @@ func Test_processPost(t *testing.T) {
 		t.Fatal("got != 2 recent posts, expected the dummy post added twice")
 	}
 
-	processNewPost(context, Post{Feed: &Feed{Id: "p2"}})
+	processNewPost(ctx, context, Post{Id: "1", Feed: &Feed{Id: "p2"}})
 	if !listener.invokedWithCross {
 		t.Error("mock listener should have been invoked, but it was not")
 	}
@@ -236,6 +272,42 @@ func Test_processPost(t *testing.T) {
 	}
 }
 
+type mockEventListener struct {
+	mockListener
+	events []Event
+}
+
+func (listener *mockEventListener) OnEvent(ctx context.Context, event Event) error {
+	listener.events = append(listener.events, event)
+	return nil
+}
+
+func Test_processPost_notifies_event_with_detector_and_score(t *testing.T) {
+	feed := &Feed{Id: "p1"}
+
+	listener := &mockEventListener{}
+	ctx := context.Background()
+	context := &Context{
+		Detectors:      []Detector{SameBodyDetector{}},
+		Listeners:      []Listener{listener},
+		PostRepository: NewPostRepository(),
+	}
+
+	processNewPost(ctx, context, Post{Id: "1", Body: "hello", Feed: feed})
+	processNewPost(ctx, context, Post{Id: "2", Body: "hello", Feed: feed})
+
+	if len(listener.events) != 1 {
+		t.Fatalf("got %d events; expected 1", len(listener.events))
+	}
+	event := listener.events[0]
+	if event.Kind != DuplicateEvent || event.Detector != "SameBodyDetector" || event.Score != 1 {
+		t.Fatalf("got %#v; expected duplicate found by SameBodyDetector with score 1", event)
+	}
+	if listener.invokedWithDups {
+		t.Fatal("got OnDuplicate invoked; expected OnEvent instead")
+	}
+}
+
 type mockReader struct {
 	post Post
 }
@@ -244,8 +316,8 @@ func (reader *mockReader) GetFeed() Feed {
 	return Feed{Id: "dummy"}
 }
 
-func (reader *mockReader) FetchNewPosts() []Post {
-	return []Post{{}}
+func (reader *mockReader) FetchNewPosts(ctx context.Context) ([]Post, error) {
+	return []Post{{}}, nil
 }
 
 func Test_waitForPosts(t *testing.T) {
@@ -254,27 +326,26 @@ func Test_waitForPosts(t *testing.T) {
 	reader := &mockReader{post: post}
 	posts := make(chan Post)
 
-	go waitForPosts(reader, posts, 1)
+	go waitForPosts(context.Background(), reader, posts, 1)
 
 	if received := <-posts; received != post {
 		t.Fatalf("got %#v, expected %#v", received, post)
 	}
 }
 
-func restoreDefaultCount() {
-	defaultCount = getDefaultCount()
+// isFetchError tells if running once failed only because the feeds could not be fetched, like without network
+func isFetchError(err error) bool {
+	return strings.HasPrefix(err.Error(), "could not fetch feed(s)")
 }
 
 func Test_run(t *testing.T) {
-	defaultCount = 0
-	defer restoreDefaultCount()
-
 	post := Post{}
 
 	reader := &mockReader{post: post}
 	listener := &mockListener{}
 	repo := NewPostRepository()
 
+	ctx := context.Background()
 	context := &Context{
 		Readers:        []FeedReader{reader},
 		Detectors:      []Detector{SameBodyDetector{}},
@@ -282,51 +353,45 @@ func Test_run(t *testing.T) {
 		PostRepository: repo,
 	}
 
-	run(context, 1)
+	run(ctx, context, 1)
 
 	if !reflect.DeepEqual([]Post{post}, repo.FindRecent()) {
 		t.Fatalf("got %#v, expected []Post{%#v}", repo.FindRecent(), post)
 	}
 }
 
-func Test_RunForever_fails_if_config_file_nonexistent(t *testing.T) {
-	defaultCount = 0
-	defer restoreDefaultCount()
-
-	if RunForever("xpd.yml.example") != nil {
-		t.Fatal("got failure; expected RunForever to succeed with valid config file")
+func Test_Run_fails_if_config_file_nonexistent(t *testing.T) {
+	if err := Run("xpd.yml.example", RunOptions{Once: true}); err != nil && !isFetchError(err) {
+		t.Fatalf("got failure: %s; expected Run to succeed with valid config file", err)
 	}
 
-	if RunForever("nonexistent") == nil {
-		t.Fatal("got success; expected RunForever to fail if config file nonexistent")
+	if Run("nonexistent", RunOptions{Once: true}) == nil {
+		t.Fatal("got success; expected Run to fail if config file nonexistent")
 	}
 }
 
-func Test_runForever_fails_if_config_invalid(t *testing.T) {
-	defaultCount = 0
-	defer restoreDefaultCount()
-
+func Test_runOnceAndShutdown_fails_if_config_invalid(t *testing.T) {
 	validConfig := &Config{
 		Feeds:     []Feed{{}},
 		Detectors: []TypeConfig{{Type: "SimilarWordCountDetector"}},
 	}
 
-	if err := runForever(validConfig); err != nil {
-		t.Fatalf("got failure: %s; runForever should have worked with valid config", err)
+	if err := runOnceAndShutdown(validConfig, RunOptions{}); err != nil && !isFetchError(err) {
+		t.Fatalf("got failure: %s; runOnceAndShutdown should have worked with valid config", err)
 	}
 
 	var brokenConfig Config
 
 	brokenConfig = *validConfig
 	brokenConfig.Feeds = nil
-	if runForever(&brokenConfig) == nil {
-		t.Fatal("got success; expected runForever to fail if feeds missing")
+	if runOnceAndShutdown(&brokenConfig, RunOptions{}) == nil {
+		t.Fatal("got success; expected runOnceAndShutdown to fail if feeds missing")
 	}
 
 	brokenConfig = *validConfig
 	brokenConfig.Detectors = nil
-	if runForever(&brokenConfig) == nil {
-		t.Fatal("got success; expected runForever to fail if detectors missing")
+	if runOnceAndShutdown(&brokenConfig, RunOptions{}) == nil {
+		t.Fatal("got success; expected runOnceAndShutdown to fail if detectors missing")
 	}
 }
 
@@ -335,3 +400,69 @@ func Test_defaultCount(t *testing.T) {
 		t.Fatalf("got defaultCount = %d; expected %d", getDefaultCount(), expected)
 	}
 }
+
+func Test_run_stops_when_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	repo := NewPostRepository()
+	context := &Context{
+		Readers:        []FeedReader{&mockReader{}},
+		Detectors:      []Detector{SameBodyDetector{}},
+		PostRepository: repo,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		run(ctx, context, defaultCount)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("got run still running; expected it to stop when cancelled")
+	}
+}
+
+func Test_processNewPost_edited_post(t *testing.T) {
+	so, gg := &Feed{Id: "so"}, &Feed{Id: "gg"}
+	listener := &mockEventListener{}
+	ctx := context.Background()
+	context := &Context{
+		Detectors:      []Detector{SameBodyDetector{}},
+		Listeners:      []Listener{listener},
+		PostRepository: NewPostRepository(),
+	}
+
+	processNewPost(ctx, context, Post{Id: "1", Body: "how to?", Feed: gg})
+	processNewPost(ctx, context, Post{Id: "2", Body: "draft", Feed: so})
+	if len(listener.events) != 0 {
+		t.Fatalf("got %#v; expected no events", listener.events)
+	}
+
+	processNewPost(ctx, context, Post{Id: "2", Body: "how to?", Feed: so, Edited: true})
+	if len(listener.events) != 1 || listener.events[0].Kind != CrossPostEvent || !listener.events[0].Edited {
+		t.Fatalf("got %#v; expected an edited cross-post", listener.events)
+	}
+	if recent := context.PostRepository.FindRecent(); len(recent) != 2 || recent[1].Body != "how to?" {
+		t.Fatalf("got %#v; expected the post replaced", recent)
+	}
+
+	// an edit that does not change the matches
+	processNewPost(ctx, context, Post{Id: "2", Body: "how to?", Feed: so, Edited: true})
+	if len(listener.events) != 1 {
+		t.Fatalf("got %#v; expected no new event", listener.events)
+	}
+
+	processNewPost(ctx, context, Post{Id: "2", Body: "solved", Feed: so, Edited: true})
+	if len(listener.events) != 2 || listener.events[1].Kind != NoLongerMatchesEvent || listener.events[1].Posts[0].Id != "1" {
+		t.Fatalf("got %#v; expected the post no longer matching", listener.events)
+	}
+
+	// edited posts never seen before are new posts
+	processNewPost(ctx, context, Post{Id: "3", Body: "solved", Feed: gg, Edited: true})
+	if len(listener.events) != 3 || listener.events[2].Kind != CrossPostEvent || listener.events[2].Edited {
+		t.Fatalf("got %#v; expected a cross-post of a new post", listener.events)
+	}
+}